@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/wiki"
+)
+
+// handleBackfill documents past commits as a series of wiki commits:
+//
+//	repowiki backfill [--every N | --tags] [--branch name | --output-dir dir] <from>..<to>
+//	repowiki backfill            # resume an interrupted backfill
+//	repowiki backfill --abort
+func handleBackfill(args []string) {
+	fs := flag.NewFlagSet("backfill", flag.ExitOnError)
+	every := fs.Int("every", 0, "document every `N`th commit (and the last)")
+	tags := fs.Bool("tags", false, "document only tagged commits")
+	branch := fs.String("branch", "", "branch for the wiki commits (default: the wiki branch)")
+	outputDir := fs.String("output-dir", "", "write the wiki commits as format-patch files into `dir` instead")
+	abort := fs.Bool("abort", false, "forget an interrupted backfill")
+	fs.Parse(args)
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: not a git repository\n")
+		os.Exit(1)
+	}
+
+	if *abort {
+		if err := wiki.AbortBackfill(gitRoot); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println("Backfill aborted.")
+		return
+	}
+
+	cfg, err := config.Load(gitRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: repowiki not configured. Run 'repowiki enable' first.\n")
+		os.Exit(1)
+	}
+
+	opts := wiki.BackfillOptions{Range: fs.Arg(0), Every: *every, Tags: *tags, Branch: *branch}
+	if *outputDir != "" {
+		opts.OutputDir, _ = filepath.Abs(*outputDir)
+	}
+	if resuming := wiki.BackfillInProgress(gitRoot); resuming != "" && (opts.Range == "" || opts.Range == resuming) {
+		fmt.Printf("Resuming backfill of %s\n", resuming)
+	} else if opts.Range == "" {
+		fmt.Fprintf(os.Stderr, "Usage: repowiki backfill [--every N | --tags] [--branch name | --output-dir dir] <from>..<to>\n")
+		os.Exit(1)
+	}
+
+	// SIGTERM comes from `repowiki cancel`; progress so far is kept.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	res, err := wiki.Backfill(ctx, gitRoot, cfg, opts, func(step, total int, commit string) {
+		fmt.Printf("[%d/%d] %s\n", step, total, git.Describe(gitRoot, commit))
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		if wiki.BackfillInProgress(gitRoot) != "" {
+			fmt.Fprintf(os.Stderr, "Run 'repowiki backfill' again to resume.\n")
+		}
+		os.Exit(1)
+	}
+	if res.Ref != "" {
+		fmt.Printf("Backfill complete: %d wiki commits on %s\n", res.Commits, res.Ref)
+	} else {
+		fmt.Printf("Backfill complete: %d patches in %s\n", len(res.Patches), opts.OutputDir)
+	}
+}
@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/lockfile"
+)
+
+// handleCancel stops a running wiki generation. The lock holder is asked to
+// stop with SIGTERM, which kills its engine, reverts partially written wiki
+// files and releases the lock. If it doesn't exit in time it is killed.
+func handleCancel(args []string) {
+	fs := flag.NewFlagSet("cancel", flag.ExitOnError)
+	wait := fs.Duration("wait", 15*time.Second, "how long to wait for a clean shutdown before killing")
+	fs.Parse(args)
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: not a git repository\n")
+		os.Exit(1)
+	}
+
+	holder, err := lockfile.ReadHolder(gitRoot)
+	if err != nil {
+		fmt.Println("No repowiki generation is running.")
+		return
+	}
+
+	if !lockfile.IsAlive(holder.PID) {
+		lockfile.Release(gitRoot)
+		fmt.Printf("Removed stale lock (process %d is not running).\n", holder.PID)
+		return
+	}
+
+	fmt.Printf("Stopping repowiki process %d...\n", holder.PID)
+	if err := syscall.Kill(holder.PID, syscall.SIGTERM); err != nil {
+		fmt.Fprintf(os.Stderr, "Error: cannot signal process %d: %v\n", holder.PID, err)
+		os.Exit(1)
+	}
+
+	deadline := time.Now().Add(*wait)
+	for time.Now().Before(deadline) {
+		if lockReleasedBy(gitRoot, holder.PID) {
+			fmt.Println("Generation canceled; partial wiki changes were reverted.")
+			return
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	// The holder didn't shut down cleanly: kill it and its engine.
+	fmt.Printf("Process %d did not exit within %s; killing it.\n", holder.PID, *wait)
+	if holder.EnginePID > 0 {
+		syscall.Kill(-holder.EnginePID, syscall.SIGKILL)
+	}
+	syscall.Kill(holder.PID, syscall.SIGKILL)
+	lockfile.Release(gitRoot)
+
+	cfg, err := config.Load(gitRoot)
+	wikiPath := config.Default().WikiPath
+	if err == nil {
+		wikiPath = cfg.WikiPath
+	}
+	fmt.Printf("Lock released. Wiki files may be partially written; check 'git status %s'.\n", wikiPath)
+}
+
+// lockReleasedBy reports whether pid no longer holds the lock.
+func lockReleasedBy(gitRoot string, pid int) bool {
+	h, err := lockfile.ReadHolder(gitRoot)
+	return err != nil || h.PID != pid
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/wiki"
+)
+
+// handleCheckoutWiki writes the wiki from the wiki branch into the working
+// tree, for projects using branch storage.
+func handleCheckoutWiki(args []string) {
+	fs := flag.NewFlagSet("checkout-wiki", flag.ExitOnError)
+	source := fs.String("source", "", "source commit whose wiki to materialize (default: latest)")
+	fs.Parse(args)
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: not a git repository\n")
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(gitRoot)
+	if err != nil {
+		cfg = config.Default()
+	}
+
+	sourceHash := ""
+	if *source != "" {
+		sourceHash = git.ResolveRef(gitRoot, *source)
+		if sourceHash == "" {
+			fmt.Fprintf(os.Stderr, "Error: unknown commit %s\n", *source)
+			os.Exit(1)
+		}
+	}
+
+	commit, err := wiki.CheckoutWiki(gitRoot, cfg, sourceHash)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	fmt.Printf("Wiki checked out from %s into %s/\n", shortHash(commit), cfg.WikiPath)
+}
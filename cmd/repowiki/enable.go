@@ -8,18 +8,29 @@ import (
 	"strings"
 
 	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/engine"
 	"github.com/GoooIce/repowiki/internal/git"
 	"github.com/GoooIce/repowiki/internal/hook"
-	"github.com/GoooIce/repowiki/internal/wiki"
 )
 
 func handleEnable(args []string) {
 	fs := flag.NewFlagSet("enable", flag.ExitOnError)
 	force := fs.Bool("force", false, "reinstall hook even if present")
-	engine := fs.String("engine", "", "AI engine: qoder, claude-code, codex")
+	engineName := fs.String("engine", "", "AI engine: "+strings.Join(engine.Names(), ", "))
 	enginePath := fs.String("engine-path", "", "path to engine CLI binary")
 	model := fs.String("model", "", "model level (engine-specific)")
+	baseURL := fs.String("base-url", "", "API endpoint for the openai-compatible engine")
 	noAutoCommit := fs.Bool("no-auto-commit", false, "don't auto-commit wiki changes")
+	review := fs.Bool("review", false, "hold wiki changes for 'repowiki review' instead of committing")
+	storage := fs.String("storage", "", "where wiki commits go: commit (working branch) or branch (wiki branch)")
+	wikiBranch := fs.String("wiki-branch", "", "branch for --storage branch (default: "+config.DefaultWikiBranch+")")
+	commitAuthor := fs.String("commit-author", "", `identity for wiki commits, e.g. "repowiki-bot <bot@local>"`)
+	commitSign := fs.String("commit-sign", "", "sign wiki commits: off, gpg or ssh (default: follow git config)")
+	amend := fs.Bool("amend", false, "fold each wiki commit into the previous one while it's unpushed")
+	autoPush := fs.Bool("auto-push", false, "push wiki commits after making them")
+	pushRemote := fs.String("push-remote", "", "remote for --auto-push (default: "+config.DefaultPushRemote+")")
+	pushRefspec := fs.String("push-refspec", "", "refspec for --auto-push (default: the branch wiki commits go to)")
+	noSandbox := fs.Bool("no-sandbox", false, "run the engine in the working tree instead of a temporary worktree")
 	fs.Parse(args)
 
 	gitRoot, err := git.FindRoot()
@@ -35,13 +46,13 @@ func handleEnable(args []string) {
 	}
 
 	// Apply flag overrides
-	engineExplicit := *engine != ""
+	engineExplicit := *engineName != ""
 	if engineExplicit {
-		if !config.IsValidEngine(*engine) {
-			fmt.Fprintf(os.Stderr, "Error: unknown engine %q (valid: %s)\n", *engine, strings.Join(config.ValidEngines, ", "))
+		if _, err := engine.Resolve(cfg, *engineName); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
-		cfg.Engine = *engine
+		cfg.Engine = *engineName
 	}
 	if *enginePath != "" {
 		cfg.EnginePath = *enginePath
@@ -49,15 +60,64 @@ func handleEnable(args []string) {
 	if *model != "" {
 		cfg.Model = *model
 	}
+	if *baseURL != "" {
+		if cfg.Engines == nil {
+			cfg.Engines = map[string]config.EngineSettings{}
+		}
+		s := cfg.Engines[config.EngineOpenAICompatible]
+		s.BaseURL = *baseURL
+		cfg.Engines[config.EngineOpenAICompatible] = s
+	}
 	if *noAutoCommit {
 		cfg.AutoCommit = false
 	}
+	if *review {
+		cfg.Review = true
+	}
+	switch *storage {
+	case "":
+	case config.StorageCommit, config.StorageBranch:
+		cfg.Storage = *storage
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown storage mode %q (want %s or %s)\n", *storage, config.StorageCommit, config.StorageBranch)
+		os.Exit(1)
+	}
+	if *wikiBranch != "" {
+		cfg.WikiBranch = *wikiBranch
+	}
+	if *commitAuthor != "" {
+		cfg.CommitAuthor = *commitAuthor
+	}
+	switch *commitSign {
+	case "":
+	case config.SignOff, config.SignGPG, config.SignSSH:
+		cfg.CommitSign = *commitSign
+	default:
+		fmt.Fprintf(os.Stderr, "Error: unknown signing mode %q (want %s, %s or %s)\n", *commitSign, config.SignOff, config.SignGPG, config.SignSSH)
+		os.Exit(1)
+	}
+	if *amend {
+		cfg.AmendWikiCommits = true
+	}
+	if *autoPush {
+		cfg.AutoPush = true
+	}
+	if *pushRemote != "" {
+		cfg.PushRemote = *pushRemote
+	}
+	if *pushRefspec != "" {
+		cfg.PushRefspec = *pushRefspec
+	}
+	if *noSandbox {
+		off := false
+		cfg.Sandbox = &off
+	}
 	cfg.Enabled = true
 
 	// Validate engine binary is reachable
-	binPath, findErr := wiki.FindEngineBinary(cfg)
+	binPath, findErr := detectEngine(cfg)
 	if findErr != nil {
-		if engineExplicit || *enginePath != "" {
+		if engineExplicit || *enginePath != "" || *baseURL != "" {
 			// User explicitly chose this engine — fail hard
 			fmt.Fprintf(os.Stderr, "Error: %v\n", findErr)
 			fmt.Fprintf(os.Stderr, "Set the path with: repowiki enable --engine-path /path/to/binary\n")
@@ -65,10 +125,10 @@ func handleEnable(args []string) {
 		}
 		// No explicit engine — auto-detect the first available one
 		detected := false
-		for _, eng := range config.EngineDetectOrder {
+		for _, eng := range engine.DetectOrder() {
 			cfg.Engine = eng
 			cfg.EnginePath = ""
-			binPath, findErr = wiki.FindEngineBinary(cfg)
+			binPath, findErr = detectEngine(cfg)
 			if findErr == nil {
 				detected = true
 				break
@@ -76,19 +136,33 @@ func handleEnable(args []string) {
 		}
 		if !detected {
 			fmt.Fprintf(os.Stderr, "Error: no supported AI engine found\n")
-			fmt.Fprintf(os.Stderr, "Install one of: qodercli, claude, codex\n")
+			fmt.Fprintf(os.Stderr, "Install one of the supported engines: %s\n", strings.Join(engine.DetectOrder(), ", "))
 			fmt.Fprintf(os.Stderr, "Or specify a path: repowiki enable --engine claude-code --engine-path /path/to/claude\n")
 			os.Exit(1)
 		}
 		fmt.Printf("Auto-detected engine: %s (%s)\n\n", cfg.Engine, binPath)
 	}
 
+	if *model != "" {
+		if e, err := engine.Resolve(cfg, cfg.Engine); err == nil && !e.Capabilities().Model {
+			fmt.Printf("Note: engine %s ignores the model setting\n\n", cfg.Engine)
+		}
+	}
+
 	// Save config
 	if err := config.Save(gitRoot, cfg); err != nil {
 		fmt.Fprintf(os.Stderr, "Error saving config: %v\n", err)
 		os.Exit(1)
 	}
 
+	// The wiki lives on its own branch, so keep it out of the working
+	// branch's status and commits
+	if cfg.UsesWikiBranch() {
+		if err := git.Exclude(gitRoot, "/"+strings.Trim(filepath.ToSlash(cfg.WikiPath), "/")+"/"); err != nil {
+			fmt.Fprintf(os.Stderr, "Warning: could not add %s to .git/info/exclude: %v\n", cfg.WikiPath, err)
+		}
+	}
+
 	// Determine absolute path to this binary for the hook
 	selfPath, _ := os.Executable()
 
@@ -107,11 +181,20 @@ func handleEnable(args []string) {
 		fmt.Printf("  Binary:  %s\n", binPath)
 	}
 	fmt.Printf("  Config:  %s\n", config.Path(gitRoot))
-	fmt.Printf("  Hook:    .git/hooks/post-commit\n")
+	fmt.Printf("  Hooks:   .git/hooks/post-commit, .git/hooks/post-rewrite\n")
 	fmt.Printf("\nEvery commit will now auto-update the repo wiki.\n")
 	fmt.Printf("Run 'repowiki generate' for initial full wiki generation.\n")
 }
 
+// detectEngine locates the binary for the configured engine.
+func detectEngine(cfg *config.Config) (string, error) {
+	e, err := engine.Resolve(cfg, cfg.Engine)
+	if err != nil {
+		return "", err
+	}
+	return e.Detect(cfg)
+}
+
 func createQoderCommand(gitRoot string) {
 	cmdDir := filepath.Join(gitRoot, ".qoder", "commands")
 	os.MkdirAll(cmdDir, 0755)
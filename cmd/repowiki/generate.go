@@ -1,8 +1,11 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/GoooIce/repowiki/internal/config"
 	"github.com/GoooIce/repowiki/internal/git"
@@ -26,7 +29,10 @@ func handleGenerate(args []string) {
 
 	fmt.Println("Starting full wiki generation... (this may take several minutes)")
 
-	if err := wiki.FullGenerate(gitRoot, cfg, head); err != nil {
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
+	if err := wiki.FullGenerate(ctx, gitRoot, cfg, head, nil); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -1,25 +1,40 @@
 package main
 
 import (
+	"bufio"
 	"fmt"
+	"io"
 	"os"
 	"os/exec"
 	"strings"
 	"syscall"
+	"time"
 
+	"github.com/GoooIce/repowiki/internal/budget"
 	"github.com/GoooIce/repowiki/internal/config"
 	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/history"
+	"github.com/GoooIce/repowiki/internal/hook"
 	"github.com/GoooIce/repowiki/internal/lockfile"
 	"github.com/GoooIce/repowiki/internal/wiki"
 )
 
-// handleHooks is the entry point called by the git post-commit hook.
-// It runs loop prevention checks and spawns a background update process.
+// handleHooks is the entry point called by the git hooks.
 func handleHooks(args []string) {
-	if len(args) == 0 || args[0] != "post-commit" {
+	if len(args) == 0 {
 		return
 	}
+	switch args[0] {
+	case hook.PostCommit:
+		handlePostCommit()
+	case hook.PostRewrite:
+		handlePostRewrite(os.Stdin)
+	}
+}
 
+// handlePostCommit runs loop prevention checks and spawns a background
+// update process.
+func handlePostCommit() {
 	gitRoot, err := git.FindRoot()
 	if err != nil {
 		return
@@ -56,7 +71,66 @@ func handleHooks(args []string) {
 		return
 	}
 
-	// All checks passed — spawn background update process
+	// Commits made by an amend or rebase are handled once the rewrite is
+	// done, by the post-rewrite hook
+	if git.IsRewriting(gitRoot) && hook.IsHookInstalled(gitRoot, hook.PostRewrite) {
+		return
+	}
+
+	// All checks passed
+	startUpdate(gitRoot, cfg, commitHash)
+}
+
+// handlePostRewrite runs after `commit --amend` and rebase, which git
+// reports as "old new" lines on stdin. It points the last processed
+// commit, the queue and a --no-regenerate hold at the rewritten commits,
+// then starts one update if the rewrite left changes undocumented. Replayed
+// commits whose changes are already in the wiki are not processed again.
+func handlePostRewrite(stdin io.Reader) {
+	rewritten := map[string]string{}
+	sc := bufio.NewScanner(stdin)
+	for sc.Scan() {
+		if f := strings.Fields(sc.Text()); len(f) >= 2 {
+			rewritten[f[0]] = f[1]
+		}
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil || len(rewritten) == 0 || wiki.IsSentinelPresent(gitRoot) {
+		return
+	}
+	cfg, err := config.Load(gitRoot)
+	if err != nil || !cfg.Enabled {
+		return
+	}
+	// A running update applies the mapping and catches up with HEAD when
+	// it finishes
+	if applied, err := wiki.RemapRewritten(gitRoot, rewritten); err != nil || !applied {
+		return
+	}
+	if cfg, err = config.Load(gitRoot); err != nil {
+		return
+	}
+	head, err := git.HeadCommit(gitRoot)
+	if err != nil || !hasUnprocessedCommits(gitRoot, cfg, head) {
+		return
+	}
+	startUpdate(gitRoot, cfg, head)
+}
+
+// startUpdate spawns a background update for commitHash, or queues it if
+// a budget is exhausted.
+func startUpdate(gitRoot string, cfg *config.Config, commitHash string) {
+	// Over budget: queue the commit instead of spawning an engine run
+	if budget.Limited(cfg) {
+		if runs, err := history.Load(gitRoot); err == nil {
+			if st := budget.Check(cfg, runs, time.Now()); st.Exhausted {
+				budget.Enqueue(gitRoot, commitHash, st.Reason)
+				return
+			}
+		}
+	}
+
 	spawnBackground(gitRoot, commitHash)
 }
 
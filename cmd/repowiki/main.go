@@ -28,6 +28,20 @@ func main() {
 		handleHooks(os.Args[2:])
 	case "logs":
 		handleLogs(os.Args[2:])
+	case "cancel":
+		handleCancel(os.Args[2:])
+	case "usage":
+		handleUsage(os.Args[2:])
+	case "checkout-wiki":
+		handleCheckoutWiki(os.Args[2:])
+	case "review":
+		handleReview(os.Args[2:])
+	case "squash":
+		handleSquash(os.Args[2:])
+	case "revert":
+		handleRevert(os.Args[2:])
+	case "backfill":
+		handleBackfill(os.Args[2:])
 	case "version", "--version", "-v":
 		fmt.Printf("repowiki v%s\n", Version)
 	case "help", "--help", "-h":
@@ -41,7 +55,8 @@ func main() {
 func printUsage() {
 	fmt.Printf(`repowiki v%s — Auto-generate repo wiki on git commits
 
-Supports multiple AI engines: Qoder CLI, Claude Code, OpenAI Codex CLI.
+Supports multiple AI engines: Qoder CLI, Claude Code, OpenAI Codex CLI,
+OpenAI-compatible HTTP endpoints, and external repowiki-engine-<name> plugins on PATH.
 
 Usage:
   repowiki <command> [flags]
@@ -53,18 +68,58 @@ Commands:
   generate    Run full wiki generation
   update      Run incremental wiki update for recent changes
   logs        Show latest generation log
+  cancel      Stop a running background generation
+  usage       Show token usage and spend per day or month
+  checkout-wiki  Materialize the wiki from the wiki branch
+  review      List, diff, accept or reject changesets held for review
+  squash      Fold consecutive unpushed wiki commits into one
+  revert      Undo the wiki changes of wiki commits
+  backfill    Document past commits as a series of wiki commits
   version     Show version
 
 Flags for 'enable':
-  --engine            AI engine: qoder, claude-code, codex (default: qoder)
+  --engine            AI engine: qoder, claude-code, codex, or a plugin name (default: qoder)
   --engine-path       Path to engine CLI binary
   --model             Model level (engine-specific)
+  --base-url          API endpoint for the openai-compatible engine
   --force             Reinstall hook even if already present
   --no-auto-commit    Don't auto-commit wiki changes
+  --review            Hold wiki changes for 'repowiki review' instead of committing
+  --no-sandbox        Run the engine in the working tree instead of a temporary worktree
+  --commit-author     Identity for wiki commits, e.g. "repowiki-bot <bot@local>"
+  --commit-sign       Sign wiki commits: off, gpg or ssh (default: follow git config)
+  --storage           Where wiki commits go: commit (working branch) or branch
+  --wiki-branch       Wiki branch for --storage branch (default: repowiki/wiki)
+  --auto-push         Push wiki commits after making them
+  --push-remote       Remote for --auto-push (default: origin)
+  --push-refspec      Refspec for --auto-push (default: the branch wiki commits go to)
+  --amend             Fold each wiki commit into the previous one while it's unpushed
 
 Flags for 'update':
   --commit            Specific commit hash to process
   --from-hook         Internal: indicates hook-triggered run
+  --record <dir>      Record engine invocations as replayable cassettes
+  --replay <dir>      Re-apply recorded cassettes instead of calling the engine
+  --output-patch <f>  Write wiki changes to a format-patch file, leaving the checkout clean
+  --output-dir <dir>  Like --output-patch, with a file named after the commit subject
+
+Flags for 'usage':
+  --monthly           Group by month instead of by day
+  --days              Number of days to show (default: 30)
+
+Flags for 'revert':
+  --last N            Revert the last N wiki commits (or name wiki commits as arguments)
+  --no-regenerate     Don't let automatic updates regenerate the reverted source changes
+
+Flags for 'backfill':
+  --every N           Document every Nth commit of the range (and the last)
+  --tags              Document only tagged commits
+  --branch            Branch for the wiki commits (default: the wiki branch)
+  --output-dir <dir>  Write the wiki commits as format-patch files instead
+  --abort             Forget an interrupted backfill
+
+Flags for 'checkout-wiki':
+  --source            Source commit whose wiki to materialize (default: latest)
 
 Examples:
   repowiki enable                               # Enable with Qoder (default)
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/wiki"
+)
+
+// handleRevert undoes the wiki changes of wiki commits:
+//
+//	repowiki revert --last N [--no-regenerate]
+//	repowiki revert [--no-regenerate] <wiki-commit>...
+func handleRevert(args []string) {
+	fs := flag.NewFlagSet("revert", flag.ExitOnError)
+	last := fs.Int("last", 0, "revert the last `N` wiki commits")
+	noRegenerate := fs.Bool("no-regenerate", false, "don't let automatic updates regenerate the reverted source changes")
+	fs.Parse(args)
+
+	if (*last > 0) == (fs.NArg() > 0) {
+		fmt.Fprintf(os.Stderr, "Usage: repowiki revert [--no-regenerate] (--last N | <wiki-commit>...)\n")
+		os.Exit(1)
+	}
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: not a git repository\n")
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(gitRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: repowiki not configured. Run 'repowiki enable' first.\n")
+		os.Exit(1)
+	}
+
+	commits, err := wiki.FindWikiCommits(gitRoot, cfg, *last, fs.Args())
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	res, err := wiki.Revert(gitRoot, cfg, commits, *noRegenerate)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	printReverted(gitRoot, commits, res, *noRegenerate)
+}
+
+func printReverted(gitRoot string, commits []string, res *wiki.RevertResult, held bool) {
+	if res.Commit == "" {
+		fmt.Println("Nothing to revert: the wiki already matches.")
+	} else {
+		fmt.Printf("Reverted %d wiki commits in %s.\n", len(commits), shortHash(res.Commit))
+	}
+	switch {
+	case held:
+		fmt.Printf("Automatic updates will skip source commits %s..%s; run 'repowiki update' to regenerate them.\n",
+			sourceStart(gitRoot, res.From), shortHash(res.To))
+	case res.From != "":
+		fmt.Printf("Last processed commit reset to %s; the next update regenerates the changes since.\n", sourceStart(gitRoot, res.From))
+	}
+}
+
+// sourceStart names the start of a source range: a commit, or the empty
+// tree before the root commit.
+func sourceStart(gitRoot string, hash string) string {
+	if hash == git.EmptyTree(gitRoot) {
+		return "(root)"
+	}
+	return shortHash(hash)
+}
@@ -0,0 +1,109 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/wiki"
+)
+
+// handleReview manages wiki changesets held for review:
+//
+//	repowiki review [list]
+//	repowiki review diff <id>
+//	repowiki review accept [--force] <id>...
+//	repowiki review reject <id>...
+//
+// IDs may be abbreviated to any unique prefix.
+func handleReview(args []string) {
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: not a git repository\n")
+		os.Exit(1)
+	}
+
+	action := "list"
+	if len(args) > 0 {
+		action, args = args[0], args[1:]
+	}
+
+	switch action {
+	case "list":
+		listPending(gitRoot)
+	case "diff":
+		for _, p := range findPending(gitRoot, args) {
+			if err := p.Diff(gitRoot, os.Stdout); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+		}
+	case "accept":
+		fs := flag.NewFlagSet("review accept", flag.ExitOnError)
+		force := fs.Bool("force", false, "accept even if the wiki files changed since the changeset was made")
+		fs.Parse(args)
+
+		cfg, err := config.Load(gitRoot)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: repowiki not configured. Run 'repowiki enable' first.\n")
+			os.Exit(1)
+		}
+		for _, p := range findPending(gitRoot, fs.Args()) {
+			if err := wiki.AcceptPending(gitRoot, cfg, p, *force); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Accepted %s (%d files).\n", p.ID, len(p.Files))
+		}
+	case "reject":
+		for _, p := range findPending(gitRoot, args) {
+			if err := wiki.RejectPending(gitRoot, p); err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			fmt.Printf("Rejected %s.\n", p.ID)
+		}
+	default:
+		fmt.Fprintf(os.Stderr, "Unknown review action: %s\nUsage: repowiki review [list|diff|accept|reject] <id>...\n", action)
+		os.Exit(1)
+	}
+}
+
+func listPending(gitRoot string) {
+	list, err := wiki.ListPending(gitRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(list) == 0 {
+		fmt.Println("No changesets pending review.")
+		return
+	}
+	for _, p := range list {
+		conflict := ""
+		if len(p.Conflicts(gitRoot)) > 0 {
+			conflict = "  (conflicts with working tree)"
+		}
+		fmt.Printf("%s  %s  %3d files  %s%s\n", p.ID, shortHash(p.Source), len(p.Files), p.Description, conflict)
+	}
+}
+
+// findPending resolves changeset IDs, exiting on any that don't match.
+func findPending(gitRoot string, ids []string) []*wiki.Pending {
+	if len(ids) == 0 {
+		fmt.Fprintf(os.Stderr, "Error: no changeset given; run 'repowiki review' to list them\n")
+		os.Exit(1)
+	}
+	var list []*wiki.Pending
+	for _, id := range ids {
+		p, err := wiki.FindPending(gitRoot, id)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		list = append(list, p)
+	}
+	return list
+}
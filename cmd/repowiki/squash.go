@@ -0,0 +1,40 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/wiki"
+)
+
+// handleSquash folds the consecutive unpushed wiki commits at the tip of
+// the wiki's branch into one.
+func handleSquash(args []string) {
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: not a git repository\n")
+		os.Exit(1)
+	}
+
+	cfg, err := config.Load(gitRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: repowiki not configured. Run 'repowiki enable' first.\n")
+		os.Exit(1)
+	}
+
+	folded, stranded, err := wiki.Squash(gitRoot, cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if folded == 0 {
+		fmt.Println("Nothing to squash: fewer than two unpushed wiki commits at the tip.")
+	} else {
+		fmt.Printf("Squashed %d wiki commits into one.\n", folded)
+	}
+	if stranded > 0 {
+		fmt.Printf("%d older unpushed wiki commits are separated by other commits and were left alone.\n", stranded)
+	}
+}
@@ -4,9 +4,14 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
+	"github.com/GoooIce/repowiki/internal/budget"
 	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/engine"
 	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/history"
 	"github.com/GoooIce/repowiki/internal/hook"
 	"github.com/GoooIce/repowiki/internal/wiki"
 )
@@ -39,15 +44,24 @@ func handleStatus(args []string) {
 
 	// Hook
 	if hook.IsInstalled(gitRoot) {
-		fmt.Printf("  Hook:         installed (.git/hooks/post-commit)\n")
+		if missing := hook.Missing(gitRoot); len(missing) > 0 {
+			fmt.Printf("  Hook:         installed (.git/hooks/post-commit); %s missing, run 'repowiki enable' to add it\n", strings.Join(missing, ", "))
+		} else {
+			fmt.Printf("  Hook:         installed (.git/hooks/post-commit, .git/hooks/post-rewrite)\n")
+		}
 	} else {
 		fmt.Printf("  Hook:         not installed\n")
 	}
 
 	// Engine binary
-	binPath, engineErr := wiki.FindEngineBinary(cfg)
+	binPath, engineErr := detectEngine(cfg)
 	if engineErr == nil {
 		fmt.Printf("  Binary:       %s\n", binPath)
+		if e, err := engine.Resolve(cfg, cfg.Engine); err == nil {
+			if v, err := e.Version(cfg); err == nil && v != "" {
+				fmt.Printf("  Version:      %s\n", v)
+			}
+		}
 	} else {
 		fmt.Printf("  Binary:       not found (%s)\n", cfg.Engine)
 	}
@@ -67,13 +81,96 @@ func handleStatus(args []string) {
 		fmt.Printf("  Model:        %s\n", cfg.Model)
 	}
 	fmt.Printf("  Auto-commit:  %v\n", cfg.AutoCommit)
+	if cfg.UsesWikiBranch() {
+		branch := strings.TrimPrefix(cfg.WikiBranchRef(), "refs/heads/")
+		if tip := wiki.WikiBranchTip(gitRoot, cfg); tip != "" {
+			fmt.Printf("  Storage:      branch %s (at %s)\n", branch, shortHash(tip))
+		} else {
+			fmt.Printf("  Storage:      branch %s (not created yet)\n", branch)
+		}
+	}
+	if cfg.AutoPush {
+		fmt.Printf("  Auto-push:    %s\n", cfg.PushTo())
+	}
 	fmt.Printf("  Max turns:    %d\n", cfg.MaxTurns)
 
 	if cfg.LastRun != "" {
 		fmt.Printf("  Last run:     %s\n", cfg.LastRun)
 	}
-	if cfg.LastCommitHash != "" {
-		fmt.Printf("  Last commit:  %s\n", cfg.LastCommitHash)
+	if last := cfg.LastCommitHash; last != "" {
+		if last == git.EmptyTree(gitRoot) {
+			last = "(root)"
+		}
+		fmt.Printf("  Last commit:  %s\n", last)
+	}
+	if r := cfg.NoRegenerate; r != nil && r.From == cfg.LastCommitHash {
+		fmt.Printf("  Skipping:     %s..%s (reverted; automatic updates won't regenerate it)\n", sourceStart(gitRoot, r.From), shortHash(r.To))
+	}
+
+	// Usage
+	if runs, err := history.Load(gitRoot); err == nil && len(runs) > 0 {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		fmt.Printf("  Today:        %s\n", formatTotals(history.Total(history.Since(runs, today))))
+		fmt.Printf("  This month:   %s\n", formatTotals(history.Total(history.Since(runs, month))))
+	}
+
+	// Budget
+	if budget.Limited(cfg) {
+		runs, _ := history.Load(gitRoot)
+		st := budget.Check(cfg, runs, time.Now())
+		if st.Exhausted {
+			fmt.Printf("  Budget:       exhausted — %s, resumes %s\n",
+				st.Reason, st.Until.Local().Format("2006-01-02 15:04"))
+		} else {
+			fmt.Printf("  Budget:       ok (%s)\n", formatBudget(cfg, st))
+		}
+	}
+	if pending, err := wiki.ListPending(gitRoot); err == nil && len(pending) > 0 {
+		fmt.Printf("  Review:       %d changesets pending (run 'repowiki review')\n", len(pending))
+	}
+	if queue, err := budget.LoadQueue(gitRoot); err == nil && len(queue) > 0 {
+		fmt.Printf("  Queued:       %d commits (run 'repowiki update' to process now)\n", len(queue))
+	}
+	if r := wiki.BackfillInProgress(gitRoot); r != "" {
+		fmt.Printf("  Backfill:     %s interrupted (run 'repowiki backfill' to resume)\n", r)
+	}
+}
+
+// formatBudget lists usage against each configured limit.
+func formatBudget(cfg *config.Config, st budget.Status) string {
+	var parts []string
+	if cfg.MaxRunsPerHour > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d runs this hour", st.RunsHour, cfg.MaxRunsPerHour))
+	}
+	if cfg.MaxRunsPerDay > 0 {
+		parts = append(parts, fmt.Sprintf("%d/%d runs in 24h", st.RunsDay, cfg.MaxRunsPerDay))
+	}
+	if cfg.MaxTokensPerDay > 0 {
+		parts = append(parts, fmt.Sprintf("%s/%s tokens in 24h", formatCount(st.TokensDay), formatCount(cfg.MaxTokensPerDay)))
+	}
+	if cfg.MaxCostPerDay > 0 {
+		parts = append(parts, fmt.Sprintf("$%.2f/$%.2f in 24h", st.CostDay, cfg.MaxCostPerDay))
+	}
+	return strings.Join(parts, ", ")
+}
+
+// formatTotals renders run, token and cost totals on one line.
+func formatTotals(t history.Totals) string {
+	return fmt.Sprintf("%d runs, %s tokens in, %s out, $%.2f",
+		t.Runs, formatCount(t.InputTokens+t.CachedTokens), formatCount(t.OutputTokens), t.CostUSD)
+}
+
+// formatCount abbreviates large token counts (12.3k, 4.5M).
+func formatCount(n int) string {
+	switch {
+	case n >= 1_000_000:
+		return fmt.Sprintf("%.1fM", float64(n)/1_000_000)
+	case n >= 1_000:
+		return fmt.Sprintf("%.1fk", float64(n)/1_000)
+	default:
+		return fmt.Sprintf("%d", n)
 	}
 }
 
@@ -1,12 +1,20 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"time"
 
+	"github.com/GoooIce/repowiki/internal/budget"
 	"github.com/GoooIce/repowiki/internal/config"
 	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/history"
 	"github.com/GoooIce/repowiki/internal/wiki"
 )
 
@@ -14,8 +22,34 @@ func handleUpdate(args []string) {
 	fs := flag.NewFlagSet("update", flag.ExitOnError)
 	commitHash := fs.String("commit", "", "specific commit hash to process")
 	fromHook := fs.Bool("from-hook", false, "internal: hook-triggered run")
+	record := fs.String("record", "", "record engine invocations as cassettes into `dir`")
+	replay := fs.String("replay", "", "replay recorded cassettes from `dir` instead of running the engine")
+	outputPatch := fs.String("output-patch", "", "write wiki changes to a format-patch `file` instead of committing")
+	outputDir := fs.String("output-dir", "", "write wiki changes as a format-patch file into `dir` instead of committing")
 	fs.Parse(args)
 
+	if *record != "" && *replay != "" {
+		fmt.Fprintf(os.Stderr, "Error: --record and --replay are mutually exclusive\n")
+		os.Exit(1)
+	}
+	if *outputPatch != "" && *outputDir != "" {
+		fmt.Fprintf(os.Stderr, "Error: --output-patch and --output-dir are mutually exclusive\n")
+		os.Exit(1)
+	}
+	opts := &wiki.Options{Record: *record, Replay: *replay}
+	// git runs in the repository root; resolve paths against the caller's
+	// directory first.
+	if *outputPatch != "" {
+		opts.Patch, _ = filepath.Abs(*outputPatch)
+	}
+	if *outputDir != "" {
+		opts.PatchDir, _ = filepath.Abs(*outputDir)
+	}
+
+	// SIGTERM comes from `repowiki cancel`; stop the engine and clean up.
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+
 	gitRoot, err := git.FindRoot()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Error: not a git repository\n")
@@ -37,7 +71,10 @@ func handleUpdate(args []string) {
 		}
 	}
 
-	if err := runUpdateCycle(gitRoot, cfg, hash, *fromHook); err != nil {
+	if err := runUpdateCycle(ctx, gitRoot, cfg, hash, *fromHook, opts); err != nil {
+		if errors.Is(err, budget.ErrExhausted) {
+			return
+		}
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
@@ -46,7 +83,7 @@ func handleUpdate(args []string) {
 	// If a commit happened while we held the lock, its hook exited silently.
 	// Re-run to pick up those missed changes.
 	if *fromHook {
-		for i := 0; i < 5; i++ { // cap retries to avoid runaway loops
+		for i := 0; i < 5 && ctx.Err() == nil; i++ { // cap retries to avoid runaway loops
 			cfg, err = config.Load(gitRoot)
 			if err != nil {
 				break
@@ -58,14 +95,21 @@ func handleUpdate(args []string) {
 			if !hasUnprocessedCommits(gitRoot, cfg, head) {
 				break
 			}
-			if err := runUpdateCycle(gitRoot, cfg, head, true); err != nil {
+			if err := runUpdateCycle(ctx, gitRoot, cfg, head, true, opts); err != nil {
 				break
 			}
 		}
 	}
 
 	if !*fromHook {
-		fmt.Println("Wiki update complete.")
+		switch {
+		case opts.PatchFile != "":
+			fmt.Printf("Wiki changes written to %s\n", opts.PatchFile)
+		case opts.Patch != "" || opts.PatchDir != "":
+			fmt.Println("No wiki changes; no patch written.")
+		default:
+			fmt.Println("Wiki update complete.")
+		}
 	}
 }
 
@@ -80,12 +124,23 @@ func hasUnprocessedCommits(gitRoot string, cfg *config.Config, head string) bool
 	if err != nil {
 		return false
 	}
-	files = filterExcluded(files, cfg.ExcludedPaths)
+	files = wiki.FilterExcluded(files, cfg.ExcludedPaths)
 	return len(files) > 0
 }
 
 // runUpdateCycle performs a single update cycle: detect changes, run generation.
-func runUpdateCycle(gitRoot string, cfg *config.Config, hash string, fromHook bool) error {
+func runUpdateCycle(ctx context.Context, gitRoot string, cfg *config.Config, hash string, fromHook bool, opts *wiki.Options) error {
+	// Automatic updates skip source commits whose wiki changes were
+	// reverted with --no-regenerate; a manual update regenerates them.
+	if r := cfg.NoRegenerate; fromHook && r != nil && r.From == cfg.LastCommitHash {
+		if r.To == hash {
+			return nil
+		}
+		held := *cfg
+		held.LastCommitHash = r.To
+		cfg = &held
+	}
+
 	var changedFiles []string
 	var err error
 	if cfg.LastCommitHash != "" && cfg.LastCommitHash != hash {
@@ -97,41 +152,92 @@ func runUpdateCycle(gitRoot string, cfg *config.Config, hash string, fromHook bo
 		return fmt.Errorf("detecting changes: %w", err)
 	}
 
-	changedFiles = filterExcluded(changedFiles, cfg.ExcludedPaths)
+	changedFiles = wiki.FilterExcluded(changedFiles, cfg.ExcludedPaths)
 
 	if len(changedFiles) == 0 {
 		if !fromHook {
 			fmt.Println("No relevant file changes detected.")
 		}
+		dequeueCovered(gitRoot, hash)
 		return nil
 	}
 
+	// Budgets only limit automatic updates; a manual update runs anyway
+	// and drains the queue.
+	if fromHook && opts.Replay == "" {
+		if err := checkBudget(gitRoot, cfg, hash); err != nil {
+			return err
+		}
+	}
+
+	// In a fresh clone the wiki lives only on the wiki branch; start from it
+	// rather than regenerating everything.
+	if cfg.UsesWikiBranch() && !wiki.Exists(gitRoot, cfg) && wiki.WikiBranchTip(gitRoot, cfg) != "" {
+		if _, err := wiki.CheckoutWiki(gitRoot, cfg, ""); err != nil {
+			return err
+		}
+	}
+
+	// A first generation held for review hasn't created the wiki yet;
+	// don't generate it again on every commit.
+	if cfg.Review && !wiki.Exists(gitRoot, cfg) {
+		if pending, _ := wiki.ListPending(gitRoot); len(pending) > 0 {
+			if !fromHook {
+				fmt.Println("Wiki generation is pending review; run 'repowiki review' first.")
+			}
+			return nil
+		}
+	}
+
 	if !wiki.Exists(gitRoot, cfg) || len(changedFiles) > cfg.FullGenerateThreshold {
 		if !fromHook {
 			fmt.Printf("Running full wiki generation (%d files changed)...\n", len(changedFiles))
 		}
-		return wiki.FullGenerate(gitRoot, cfg, hash)
+		err = wiki.FullGenerate(ctx, gitRoot, cfg, hash, opts)
+	} else {
+		if !fromHook {
+			fmt.Printf("Updating wiki for %d changed files...\n", len(changedFiles))
+		}
+		err = wiki.IncrementalUpdate(ctx, gitRoot, cfg, changedFiles, hash, opts)
 	}
+	if err == nil {
+		dequeueCovered(gitRoot, hash)
+	}
+	return err
+}
 
-	if !fromHook {
-		fmt.Printf("Updating wiki for %d changed files...\n", len(changedFiles))
+// checkBudget queues hash and returns budget.ErrExhausted if a configured
+// budget is used up.
+func checkBudget(gitRoot string, cfg *config.Config, hash string) error {
+	if !budget.Limited(cfg) {
+		return nil
+	}
+	runs, err := history.Load(gitRoot)
+	if err != nil {
+		return nil
+	}
+	st := budget.Check(cfg, runs, time.Now())
+	if !st.Exhausted {
+		return nil
 	}
-	return wiki.IncrementalUpdate(gitRoot, cfg, changedFiles, hash)
+	if err := budget.Enqueue(gitRoot, hash, st.Reason); err != nil {
+		return fmt.Errorf("queueing %s: %w", hash, err)
+	}
+	fmt.Printf("Budget exhausted (%s) until %s; queued %s\n",
+		st.Reason, st.Until.Local().Format("2006-01-02 15:04"), shortHash(hash))
+	return fmt.Errorf("%w: %s", budget.ErrExhausted, st.Reason)
 }
 
-func filterExcluded(files []string, excluded []string) []string {
-	var result []string
-	for _, f := range files {
-		skip := false
-		for _, ex := range excluded {
-			if len(f) >= len(ex) && f[:len(ex)] == ex {
-				skip = true
-				break
-			}
-		}
-		if !skip {
-			result = append(result, f)
-		}
+// dequeueCovered drops queued commits that an update of hash has covered.
+func dequeueCovered(gitRoot string, hash string) {
+	budget.Dequeue(gitRoot, func(commit string) bool {
+		return git.IsAncestor(gitRoot, commit, hash)
+	})
+}
+
+func shortHash(hash string) string {
+	if len(hash) > 8 {
+		return hash[:8]
 	}
-	return result
+	return hash
 }
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/history"
+)
+
+// handleUsage prints token and cost totals from the run history, per day
+// or per month.
+func handleUsage(args []string) {
+	fs := flag.NewFlagSet("usage", flag.ExitOnError)
+	monthly := fs.Bool("monthly", false, "group by month instead of by day")
+	days := fs.Int("days", 30, "number of days to show (daily view)")
+	fs.Parse(args)
+
+	gitRoot, err := git.FindRoot()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: not a git repository\n")
+		os.Exit(1)
+	}
+
+	runs, err := history.Load(gitRoot)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if len(runs) == 0 {
+		fmt.Println("No runs recorded yet.")
+		return
+	}
+
+	layout, label := "2006-01-02", "Day"
+	if *monthly {
+		layout, label = "2006-01", "Month"
+	} else if *days > 0 {
+		now := time.Now()
+		start := time.Date(now.Year(), now.Month(), now.Day()-*days+1, 0, 0, 0, 0, now.Location())
+		runs = history.Since(runs, start)
+	}
+
+	fmt.Printf("%-10s  %5s  %6s  %10s  %10s  %10s  %9s\n", label, "Runs", "Failed", "Input", "Cached", "Output", "Cost")
+	for _, t := range history.ByPeriod(runs, layout) {
+		printTotalsRow(t.Period, t)
+	}
+	printTotalsRow("Total", history.Total(runs))
+}
+
+func printTotalsRow(label string, t history.Totals) {
+	fmt.Printf("%-10s  %5d  %6d  %10d  %10d  %10d  %9s\n",
+		label, t.Runs, t.Failed, t.InputTokens, t.CachedTokens, t.OutputTokens, fmt.Sprintf("$%.2f", t.CostUSD))
+}
@@ -0,0 +1,106 @@
+package budget
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/history"
+)
+
+// ErrExhausted is returned when an update is deferred because a budget is
+// used up.
+var ErrExhausted = errors.New("budget exhausted")
+
+// Status is the budget usage over the rolling hour and day windows.
+type Status struct {
+	RunsHour  int
+	RunsDay   int
+	TokensDay int
+	CostDay   float64
+
+	Exhausted bool
+	Reason    string    // which limit was hit, e.g. "max_runs_per_hour (4)"
+	Until     time.Time // when enough usage ages out of the window
+}
+
+// Check evaluates the configured budgets against the run history.
+func Check(cfg *config.Config, runs []history.Run, now time.Time) Status {
+	hour := window(runs, now, time.Hour)
+	day := window(runs, now, 24*time.Hour)
+
+	s := Status{RunsHour: len(hour), RunsDay: len(day)}
+	for _, r := range day {
+		s.TokensDay += billedTokens(r.run)
+		s.CostDay += cost(r.run)
+	}
+
+	limit := func(name string, max float64, used float64, w []timedRun, per time.Duration, weight func(history.Run) float64) {
+		if max <= 0 || used < max {
+			return
+		}
+		// Drop the oldest runs until usage is back under the limit; the
+		// budget frees up once the last dropped run leaves the window.
+		for _, r := range w {
+			used -= weight(r.run)
+			if used < max {
+				if until := r.started.Add(per); until.After(s.Until) {
+					s.Until = until
+					s.Reason = name
+				}
+				break
+			}
+		}
+		s.Exhausted = true
+	}
+	one := func(history.Run) float64 { return 1 }
+	tokens := func(r history.Run) float64 { return float64(billedTokens(r)) }
+
+	limit(fmt.Sprintf("max_runs_per_hour (%d)", cfg.MaxRunsPerHour), float64(cfg.MaxRunsPerHour), float64(s.RunsHour), hour, time.Hour, one)
+	limit(fmt.Sprintf("max_runs_per_day (%d)", cfg.MaxRunsPerDay), float64(cfg.MaxRunsPerDay), float64(s.RunsDay), day, 24*time.Hour, one)
+	limit(fmt.Sprintf("max_tokens_per_day (%d)", cfg.MaxTokensPerDay), float64(cfg.MaxTokensPerDay), float64(s.TokensDay), day, 24*time.Hour, tokens)
+	limit(fmt.Sprintf("max_cost_per_day ($%.2f)", cfg.MaxCostPerDay), cfg.MaxCostPerDay, s.CostDay, day, 24*time.Hour, cost)
+	return s
+}
+
+// Limited reports whether any budget is configured.
+func Limited(cfg *config.Config) bool {
+	return cfg.MaxRunsPerHour > 0 || cfg.MaxRunsPerDay > 0 || cfg.MaxTokensPerDay > 0 || cfg.MaxCostPerDay > 0
+}
+
+type timedRun struct {
+	run     history.Run
+	started time.Time
+}
+
+// window returns the runs started within d before now, oldest first.
+func window(runs []history.Run, now time.Time, d time.Duration) []timedRun {
+	var out []timedRun
+	for _, r := range runs {
+		started, err := time.Parse(time.RFC3339, r.Started)
+		if err != nil || started.Before(now.Add(-d)) {
+			continue
+		}
+		out = append(out, timedRun{run: r, started: started})
+	}
+	sort.SliceStable(out, func(i, j int) bool { return out[i].started.Before(out[j].started) })
+	return out
+}
+
+// billedTokens counts input and output tokens; cache reads are cheap enough
+// to leave out.
+func billedTokens(r history.Run) int {
+	if r.Usage == nil {
+		return 0
+	}
+	return r.Usage.InputTokens + r.Usage.CacheCreationTokens + r.Usage.OutputTokens
+}
+
+func cost(r history.Run) float64 {
+	if r.Usage == nil {
+		return 0
+	}
+	return r.Usage.CostUSD
+}
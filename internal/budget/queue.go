@@ -0,0 +1,116 @@
+package budget
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+const queueFile = "queue.json"
+
+// Queued is a commit whose update was deferred by a budget.
+type Queued struct {
+	Commit string `json:"commit"`
+	Queued string `json:"queued"`
+	Reason string `json:"reason,omitempty"`
+}
+
+func queuePath(gitRoot string) string {
+	return filepath.Join(config.Dir(gitRoot), queueFile)
+}
+
+// LoadQueue returns the queued commits, oldest first. A missing queue file
+// means an empty queue.
+func LoadQueue(gitRoot string) ([]Queued, error) {
+	data, err := os.ReadFile(queuePath(gitRoot))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to read queue: %w", err)
+	}
+	var q []Queued
+	if err := json.Unmarshal(data, &q); err != nil {
+		return nil, fmt.Errorf("failed to parse queue: %w", err)
+	}
+	return q, nil
+}
+
+func saveQueue(gitRoot string, q []Queued) error {
+	if len(q) == 0 {
+		err := os.Remove(queuePath(gitRoot))
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	if err := os.MkdirAll(config.Dir(gitRoot), 0755); err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+	data, err := json.MarshalIndent(q, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal queue: %w", err)
+	}
+	return os.WriteFile(queuePath(gitRoot), append(data, '\n'), 0644)
+}
+
+// Enqueue adds a commit to the queue unless it is already there.
+func Enqueue(gitRoot string, commit string, reason string) error {
+	q, err := LoadQueue(gitRoot)
+	if err != nil {
+		return err
+	}
+	for _, e := range q {
+		if e.Commit == commit {
+			return nil
+		}
+	}
+	q = append(q, Queued{
+		Commit: commit,
+		Queued: time.Now().UTC().Format(time.RFC3339),
+		Reason: reason,
+	})
+	return saveQueue(gitRoot, q)
+}
+
+// Dequeue removes the queued commits for which done returns true, i.e.
+// those covered by a successful update.
+func Dequeue(gitRoot string, done func(commit string) bool) error {
+	q, err := LoadQueue(gitRoot)
+	if err != nil || len(q) == 0 {
+		return err
+	}
+	var rest []Queued
+	for _, e := range q {
+		if !done(e.Commit) {
+			rest = append(rest, e)
+		}
+	}
+	return saveQueue(gitRoot, rest)
+}
+
+// Remap points queued commits rewritten by an amend or rebase at their new
+// hashes, given git's old→new mapping.
+func Remap(gitRoot string, rewritten map[string]string) error {
+	q, err := LoadQueue(gitRoot)
+	if err != nil || len(q) == 0 {
+		return err
+	}
+	// A squash maps several commits to one; keep the first entry for it.
+	var out []Queued
+	seen := map[string]bool{}
+	for _, e := range q {
+		if c, ok := rewritten[e.Commit]; ok {
+			e.Commit = c
+		}
+		if !seen[e.Commit] {
+			seen[e.Commit] = true
+			out = append(out, e)
+		}
+	}
+	return saveQueue(gitRoot, out)
+}
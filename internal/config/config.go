@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
 	"time"
 )
 
@@ -13,9 +14,28 @@ const (
 	ConfigFile = "config.json"
 	LogDir     = "logs"
 
-	EngineQoder     = "qoder"
-	EngineClaudeCode = "claude-code"
-	EngineCodex     = "codex"
+	EngineQoder            = "qoder"
+	EngineClaudeCode       = "claude-code"
+	EngineCodex            = "codex"
+	EngineOpenAICompatible = "openai-compatible"
+	EngineFake             = "fake"
+
+	// Storage modes: wiki commits on the working branch, or on a separate
+	// orphan branch that is never checked out.
+	StorageCommit = "commit"
+	StorageBranch = "branch"
+
+	DefaultWikiBranch = "repowiki/wiki"
+	DefaultPushRemote = "origin"
+
+	// Signing modes for wiki commits. Empty follows git's commit.gpgSign.
+	SignOff = "off"
+	SignGPG = "gpg"
+	SignSSH = "ssh"
+
+	// DefaultEngineTimeout stays below the 30-minute stale lock threshold so
+	// a hung engine releases the lock before other runs would break it.
+	DefaultEngineTimeout = 25 * time.Minute
 )
 
 type Config struct {
@@ -26,12 +46,184 @@ type Config struct {
 	MaxTurns              int      `json:"max_turns"`
 	Language              string   `json:"language"`
 	AutoCommit            bool     `json:"auto_commit"`
+	Review                bool     `json:"review,omitempty"` // hold changes in .repowiki/pending instead of committing
 	CommitPrefix          string   `json:"commit_prefix"`
 	ExcludedPaths         []string `json:"excluded_paths"`
 	WikiPath              string   `json:"wiki_path"`
 	FullGenerateThreshold int      `json:"full_generate_threshold"`
 	LastRun               string   `json:"last_run,omitempty"`
 	LastCommitHash        string   `json:"last_commit_hash,omitempty"`
+
+	// NoRegenerate marks source commits whose wiki changes were reverted:
+	// while LastCommitHash is still its From, hook-triggered updates start
+	// after its To instead. Any later run clears it.
+	NoRegenerate *SourceRange `json:"no_regenerate,omitempty"`
+
+	// Sandbox runs the engine in a temporary git worktree at the target
+	// commit; only files under WikiPath are copied back. Unset means on,
+	// including for configs written before the option existed; see
+	// Sandboxed.
+	Sandbox *bool `json:"sandbox,omitempty"`
+
+	// Storage is StorageCommit (default) or StorageBranch, which commits
+	// the wiki to WikiBranch instead of the working branch.
+	Storage    string `json:"storage,omitempty"`
+	WikiBranch string `json:"wiki_branch,omitempty"`
+
+	// CommitAuthor is the identity for wiki commits, as "Name <email>"; it
+	// is used as both author and committer. Empty uses git's user config.
+	CommitAuthor string `json:"commit_author,omitempty"`
+	// CommitSign is SignOff, SignGPG or SignSSH; empty follows git config.
+	// CommitSigningKey overrides user.signingKey.
+	CommitSign       string `json:"commit_sign,omitempty"`
+	CommitSigningKey string `json:"commit_signing_key,omitempty"`
+
+	// AmendWikiCommits folds each automatic wiki commit into the previous
+	// one when that is an unpushed wiki commit directly below it.
+	AmendWikiCommits bool `json:"amend_wiki_commits,omitempty"`
+
+	// AutoPush pushes each wiki commit to PushRemote (default "origin").
+	// PushRefspec defaults to the branch the commit went to, pushed to the
+	// branch of the same name.
+	AutoPush    bool   `json:"auto_push,omitempty"`
+	PushRemote  string `json:"push_remote,omitempty"`
+	PushRefspec string `json:"push_refspec,omitempty"`
+
+	// Engines holds per-engine settings keyed by engine name.
+	Engines map[string]EngineSettings `json:"engines,omitempty"`
+
+	// FallbackEngines are tried in order when Engine fails permanently or
+	// runs out of retries.
+	FallbackEngines []string `json:"fallback_engines,omitempty"`
+	// RetryBackoff is the delay before the first retry, doubling after each
+	// attempt up to RetryBackoffMax (Go durations, default 30s and 5m).
+	RetryBackoff    string `json:"retry_backoff,omitempty"`
+	RetryBackoffMax string `json:"retry_backoff_max,omitempty"`
+
+	// Budgets for hook-triggered updates over rolling windows; zero means
+	// unlimited. Commits arriving while a budget is exhausted are queued.
+	MaxRunsPerHour  int     `json:"max_runs_per_hour,omitempty"`
+	MaxRunsPerDay   int     `json:"max_runs_per_day,omitempty"`
+	MaxTokensPerDay int     `json:"max_tokens_per_day,omitempty"`
+	MaxCostPerDay   float64 `json:"max_cost_per_day,omitempty"` // USD
+}
+
+// SourceRange is the source commits after From up to and including To.
+type SourceRange struct {
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// EngineSettings are options for a single engine. Fields that don't apply
+// to an engine are ignored.
+type EngineSettings struct {
+	BaseURL   string `json:"base_url,omitempty"`    // openai-compatible: API endpoint
+	APIKeyEnv string `json:"api_key_env,omitempty"` // openai-compatible: env var holding the API key
+
+	// Model overrides the top-level model when this engine runs. It is the
+	// only model used for fallback engines.
+	Model string `json:"model,omitempty"`
+
+	// Retries is how many times a transient failure is retried (default 0).
+	Retries int `json:"retries,omitempty"`
+
+	// Timeout bounds a single engine run, as a Go duration ("20m").
+	// Empty means DefaultEngineTimeout; "0" disables the limit.
+	Timeout string `json:"timeout,omitempty"`
+
+	// Command defines a template engine: argv with {{.Prompt}}, {{.GitRoot}},
+	// {{.WikiPath}}, {{.Model}} and {{.MaxTurns}} placeholders.
+	Command []string `json:"command,omitempty"`
+
+	// Routes pick a model by change size; the first matching route wins
+	// over Model.
+	Routes []ModelRoute `json:"routes,omitempty"`
+
+	// InputPrice and OutputPrice are USD per million tokens, used to
+	// estimate cost for engines that report tokens but not cost.
+	InputPrice  float64 `json:"input_price,omitempty"`
+	OutputPrice float64 `json:"output_price,omitempty"`
+}
+
+// ModelRoute selects Model for runs that meet every condition set on it.
+// Zero thresholds are ignored.
+type ModelRoute struct {
+	Model       string `json:"model"`
+	Kind        string `json:"kind,omitempty"` // "full" or "incremental"; empty matches both
+	MinFiles    int    `json:"min_files,omitempty"`
+	MaxFiles    int    `json:"max_files,omitempty"`
+	MinLines    int    `json:"min_lines,omitempty"`
+	MaxLines    int    `json:"max_lines,omitempty"`
+	MinSections int    `json:"min_sections,omitempty"`
+	MaxSections int    `json:"max_sections,omitempty"`
+}
+
+// Change describes the work for one run, for model routing.
+type Change struct {
+	Kind     string // "full" or "incremental"
+	Files    int    // changed source files
+	Lines    int    // added plus deleted lines in those files
+	Sections int    // affected wiki sections
+}
+
+func (r ModelRoute) matches(ch Change) bool {
+	within := func(n, lo, hi int) bool {
+		return (lo == 0 || n >= lo) && (hi == 0 || n <= hi)
+	}
+	return (r.Kind == "" || r.Kind == ch.Kind) &&
+		within(ch.Files, r.MinFiles, r.MaxFiles) &&
+		within(ch.Lines, r.MinLines, r.MaxLines) &&
+		within(ch.Sections, r.MinSections, r.MaxSections)
+}
+
+// RouteModel returns the model of the first route matching ch, or "".
+func (s EngineSettings) RouteModel(ch Change) string {
+	for _, r := range s.Routes {
+		if r.matches(ch) {
+			return r.Model
+		}
+	}
+	return ""
+}
+
+// Routed returns a copy of c with each engine's model replaced by the one
+// its routes pick for ch.
+func (c *Config) Routed(ch Change) *Config {
+	cp := *c
+	cp.Engines = make(map[string]EngineSettings, len(c.Engines))
+	for name, s := range c.Engines {
+		if m := s.RouteModel(ch); m != "" {
+			s.Model = m
+		}
+		cp.Engines[name] = s
+	}
+	return &cp
+}
+
+// UsesWikiBranch reports whether wiki commits go to a separate branch.
+func (c *Config) UsesWikiBranch() bool {
+	return c.Storage == StorageBranch
+}
+
+// WikiBranchRef returns the full ref of the wiki branch.
+func (c *Config) WikiBranchRef() string {
+	if c.WikiBranch == "" {
+		return "refs/heads/" + DefaultWikiBranch
+	}
+	return "refs/heads/" + c.WikiBranch
+}
+
+// PushTo returns the remote wiki commits are pushed to.
+func (c *Config) PushTo() string {
+	if c.PushRemote == "" {
+		return DefaultPushRemote
+	}
+	return c.PushRemote
+}
+
+// SettingsFor returns the settings for the named engine (zero value if unset).
+func (c *Config) SettingsFor(name string) EngineSettings {
+	return c.Engines[name]
 }
 
 func Default() *Config {
@@ -56,19 +248,64 @@ func Default() *Config {
 	}
 }
 
-var ValidEngines = []string{EngineQoder, EngineClaudeCode, EngineCodex}
+// Sandboxed reports whether engines run in a sandbox worktree.
+func (c *Config) Sandboxed() bool {
+	return c.Sandbox == nil || *c.Sandbox
+}
 
-// EngineDetectOrder is the order in which engines are tried during auto-detection.
-// claude-code first because it's the most commonly available.
-var EngineDetectOrder = []string{EngineClaudeCode, EngineQoder, EngineCodex}
+// EngineTimeout returns the run timeout for the named engine, or 0 for none.
+// Unparseable values fall back to DefaultEngineTimeout.
+func (c *Config) EngineTimeout(name string) time.Duration {
+	return parseDuration(c.SettingsFor(name).Timeout, DefaultEngineTimeout)
+}
 
-func IsValidEngine(engine string) bool {
-	for _, e := range ValidEngines {
-		if e == engine {
-			return true
+// EngineChain returns the primary engine followed by the fallback engines,
+// without duplicates.
+func (c *Config) EngineChain() []string {
+	chain := []string{c.Engine}
+	for _, e := range c.FallbackEngines {
+		if !slices.Contains(chain, e) {
+			chain = append(chain, e)
 		}
 	}
-	return false
+	return chain
+}
+
+// ForEngine returns a copy of c set up to run the named engine. engine_path
+// and the top-level model only apply to the primary engine.
+func (c *Config) ForEngine(name string) *Config {
+	cp := *c
+	if name != c.Engine {
+		cp.Engine = name
+		cp.EnginePath = ""
+		cp.Model = ""
+	}
+	if m := c.SettingsFor(name).Model; m != "" {
+		cp.Model = m
+	}
+	return &cp
+}
+
+// Backoff returns the delay before retry number n (starting at 1).
+func (c *Config) Backoff(n int) time.Duration {
+	initial := parseDuration(c.RetryBackoff, 30*time.Second)
+	limit := parseDuration(c.RetryBackoffMax, 5*time.Minute)
+	d := initial
+	for i := 1; i < n && d < limit; i++ {
+		d *= 2
+	}
+	return min(d, limit)
+}
+
+func parseDuration(s string, def time.Duration) time.Duration {
+	if s == "" {
+		return def
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return def
+	}
+	return d
 }
 
 func Dir(gitRoot string) string {
@@ -118,5 +355,6 @@ func UpdateLastRun(gitRoot string, commitHash string) error {
 	}
 	cfg.LastRun = time.Now().UTC().Format(time.RFC3339)
 	cfg.LastCommitHash = commitHash
+	cfg.NoRegenerate = nil
 	return Save(gitRoot, cfg)
 }
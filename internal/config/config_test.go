@@ -0,0 +1,35 @@
+package config
+
+import (
+	"os"
+	"testing"
+)
+
+func TestSandboxDefaultsOn(t *testing.T) {
+	root := t.TempDir()
+	if err := os.MkdirAll(Dir(root), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range []struct {
+		json string
+		want bool
+	}{
+		{`{"enabled": true, "engine": "claude-code"}`, true}, // written before the option existed
+		{`{"enabled": true, "sandbox": true}`, true},
+		{`{"enabled": true, "sandbox": false}`, false},
+	} {
+		if err := os.WriteFile(Path(root), []byte(tt.json), 0644); err != nil {
+			t.Fatal(err)
+		}
+		cfg, err := Load(root)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := cfg.Sandboxed(); got != tt.want {
+			t.Errorf("Sandboxed() for %s = %v, want %v", tt.json, got, tt.want)
+		}
+	}
+	if !Default().Sandboxed() {
+		t.Errorf("Default() is not sandboxed")
+	}
+}
@@ -0,0 +1,11 @@
+package engine
+
+// Built-in engines, registered in auto-detection order.
+// claude-code first because it's the most commonly available.
+func init() {
+	Register(claudeCode{})
+	Register(qoder{})
+	Register(codex{})
+	Register(openAICompatible{})
+	Register(fake{})
+}
@@ -0,0 +1,121 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ErrorClass tells the caller whether retrying a failed run can help.
+type ErrorClass int
+
+const (
+	// Permanent failures (missing binary, bad credentials, invalid config)
+	// will fail again; move on to the next engine.
+	Permanent ErrorClass = iota
+	// Transient failures (rate limits, overload, network errors, crashes,
+	// timeouts) may succeed on retry.
+	Transient
+	// Canceled means the run was stopped on purpose; don't retry at all.
+	Canceled
+)
+
+func (c ErrorClass) String() string {
+	switch c {
+	case Transient:
+		return "transient"
+	case Canceled:
+		return "canceled"
+	default:
+		return "permanent"
+	}
+}
+
+var (
+	// ErrNotInstalled is wrapped by errors for engine binaries that can't
+	// be found.
+	ErrNotInstalled = errors.New("not found")
+	// ErrUnknownEngine is wrapped by errors for engine names that resolve
+	// to nothing.
+	ErrUnknownEngine = errors.New("unknown engine")
+)
+
+// httpStatus finds HTTP status codes in error text: after "HTTP",
+// "status", "code" or "error" ("HTTP/1.1 503", "status code: 401",
+// "API Error: 529", `"status":429`), or followed by a reason phrase ("401
+// Unauthorized"). Bare numbers are ignored; stderr is full of line numbers
+// and token counts.
+var httpStatus = regexp.MustCompile(`(?i)(?:\b(?:http(?:/[\d.]+)?|status(?:[ _]code)?|code|error)"?\s*[:= ]\s*"?([1-5]\d\d)\b|\b([1-5]\d\d) (?:unauthorized|forbidden|not found|request timeout|too many requests|internal server error|bad gateway|service unavailable|gateway timeout|overloaded)\b)`)
+
+// Markers matched case-insensitively against the error text, which for CLI
+// engines includes their stderr. Permanent markers win over transient ones.
+var (
+	permanentMarkers = []string{
+		"unauthorized", "forbidden", "authentication", "not logged in",
+		"login required", "invalid api key", "invalid_api_key", "api key", "expired",
+		"credit balance", "billing", "requires a model",
+	}
+	transientMarkers = []string{
+		"rate limit", "rate_limit", "too many requests", "overloaded",
+		"bad gateway", "service unavailable", "gateway timeout",
+		"temporarily unavailable", "try again", "timeout", "timed out",
+		"connection reset", "connection refused", "econnreset", "unexpected eof", "broken pipe",
+	}
+)
+
+// statusClass classifies the HTTP status codes in msg: any client error
+// other than 408 and 429 is permanent, and those two and server errors are
+// transient. ok is false if msg has no status code.
+func statusClass(msg string) (class ErrorClass, ok bool) {
+	for _, m := range httpStatus.FindAllStringSubmatch(msg, -1) {
+		code, _ := strconv.Atoi(m[1] + m[2])
+		switch {
+		case code >= 500, code == 408, code == 429:
+			ok = true
+		case code >= 400:
+			return Permanent, true
+		}
+	}
+	return Transient, ok
+}
+
+// Classify decides whether a failed engine run is worth retrying.
+func Classify(err error) ErrorClass {
+	if err == nil {
+		return Permanent
+	}
+	if errors.Is(err, context.Canceled) {
+		return Canceled
+	}
+	if errors.Is(err, ErrTimeout) {
+		return Transient
+	}
+	if errors.Is(err, ErrNotInstalled) || errors.Is(err, ErrUnknownEngine) {
+		return Permanent
+	}
+
+	msg := strings.ToLower(err.Error())
+	if class, ok := statusClass(msg); ok {
+		return class
+	}
+	for _, m := range permanentMarkers {
+		if strings.Contains(msg, m) {
+			return Permanent
+		}
+	}
+	for _, m := range transientMarkers {
+		if strings.Contains(msg, m) {
+			return Transient
+		}
+	}
+
+	// An engine killed by a signal crashed rather than refused the work.
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && !exitErr.Exited() {
+		return Transient
+	}
+	return Permanent
+}
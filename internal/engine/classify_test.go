@@ -0,0 +1,47 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestClassify(t *testing.T) {
+	for _, tt := range []struct {
+		err  string
+		want ErrorClass
+	}{
+		{"openai-compatible: 503 Service Unavailable: upstream busy", Transient},
+		{"API Error: 529 {\"type\":\"overloaded_error\"}", Transient},
+		{"exit status 1\nstderr: HTTP/1.1 429 Too Many Requests", Transient},
+		{`exit status 1` + "\nstderr: {\"status\":502}", Transient},
+		{"openai-compatible: 401 Unauthorized: bad key", Permanent},
+		{"exit status 1\nstderr: status code: 403", Permanent},
+		{"openai-compatible: 404 Not Found: model llama9 does not exist", Permanent},
+		{"exit status 1\nstderr: Error: invalid api key", Permanent},
+		{"exit status 1\nstderr: connection reset by peer", Transient},
+		// Numbers that aren't status codes decide nothing.
+		{"exit status 1\nstderr: panic at main.go:401\nprocessed 500 files", Permanent},
+		{"exit status 1\nstderr: used 4030 tokens; connection refused", Transient},
+		{"exit status 1\nstderr: page not found in index, retrying later: try again", Transient},
+	} {
+		if got := Classify(errors.New(tt.err)); got != tt.want {
+			t.Errorf("Classify(%q) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+
+	for _, tt := range []struct {
+		err  error
+		want ErrorClass
+	}{
+		{context.Canceled, Canceled},
+		{fmt.Errorf("claude-code %w after 25m0s", ErrTimeout), Transient},
+		{fmt.Errorf("claude %w; install it or set engine_path in config", ErrNotInstalled), Permanent},
+		{fmt.Errorf("%w: nope (valid: fake)", ErrUnknownEngine), Permanent},
+	} {
+		if got := Classify(tt.err); got != tt.want {
+			t.Errorf("Classify(%v) = %s, want %s", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+// claudeCode drives Anthropic's Claude Code CLI (claude).
+type claudeCode struct{}
+
+func (claudeCode) Name() string { return config.EngineClaudeCode }
+
+func (claudeCode) Capabilities() Capabilities {
+	return Capabilities{Model: true}
+}
+
+func (claudeCode) Detect(cfg *config.Config) (string, error) {
+	// Common locations
+	home, _ := os.UserHomeDir()
+	known := []string{
+		home + "/.local/bin/claude",
+		home + "/.claude/bin/claude",
+		"/usr/local/bin/claude",
+	}
+	return findBinary(cfg, "claude", known, "install Claude Code")
+}
+
+func (c claudeCode) Version(cfg *config.Config) (string, error) {
+	bin, err := c.Detect(cfg)
+	if err != nil {
+		return "", err
+	}
+	return binaryVersion(bin)
+}
+
+func (c claudeCode) Run(ctx context.Context, cfg *config.Config, req *Request) (*Result, error) {
+	bin, err := c.Detect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{
+		"-p", req.Prompt,
+		"--output-format", "json",
+		"--dangerously-skip-permissions",
+		"--allowedTools", "Read,Write,Edit,Glob,Grep,Bash",
+	}
+	if req.Model != "" {
+		args = append(args, "--model", req.Model)
+	}
+	result, err := execCLI(ctx, bin, req.Dir, args)
+	if result != nil {
+		if perr := parseClaudeOutput(result); perr != nil && err == nil {
+			err = perr
+		}
+	}
+	return result, err
+}
+
+// claudeResult is the final message printed by `claude -p --output-format json`.
+type claudeResult struct {
+	Type         string  `json:"type"`
+	Subtype      string  `json:"subtype"`
+	IsError      bool    `json:"is_error"`
+	Result       string  `json:"result"`
+	NumTurns     int     `json:"num_turns"`
+	TotalCostUSD float64 `json:"total_cost_usd"`
+	Usage        struct {
+		InputTokens              int `json:"input_tokens"`
+		OutputTokens             int `json:"output_tokens"`
+		CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+		CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	} `json:"usage"`
+}
+
+// parseClaudeOutput replaces the raw JSON output with the result text and
+// fills in usage. Output that isn't JSON (older CLI versions) is left as is.
+func parseClaudeOutput(result *Result) error {
+	var r claudeResult
+	if err := json.Unmarshal([]byte(strings.TrimSpace(result.Output)), &r); err != nil || r.Type != "result" {
+		return nil
+	}
+	result.Output = r.Result
+	result.Usage = &Usage{
+		InputTokens:         r.Usage.InputTokens,
+		OutputTokens:        r.Usage.OutputTokens,
+		CacheReadTokens:     r.Usage.CacheReadInputTokens,
+		CacheCreationTokens: r.Usage.CacheCreationInputTokens,
+		Turns:               r.NumTurns,
+		CostUSD:             r.TotalCostUSD,
+	}
+	if r.IsError {
+		return fmt.Errorf("claude reported %s: %s", r.Subtype, r.Result)
+	}
+	return nil
+}
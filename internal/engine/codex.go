@@ -0,0 +1,92 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+// codex drives the OpenAI Codex CLI (codex).
+type codex struct{}
+
+func (codex) Name() string { return config.EngineCodex }
+
+func (codex) Capabilities() Capabilities {
+	return Capabilities{}
+}
+
+func (codex) Detect(cfg *config.Config) (string, error) {
+	return findBinary(cfg, "codex", nil, "install OpenAI Codex CLI")
+}
+
+func (c codex) Version(cfg *config.Config) (string, error) {
+	bin, err := c.Detect(cfg)
+	if err != nil {
+		return "", err
+	}
+	return binaryVersion(bin)
+}
+
+func (c codex) Run(ctx context.Context, cfg *config.Config, req *Request) (*Result, error) {
+	bin, err := c.Detect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{
+		"exec", req.Prompt,
+		"--full-auto",
+		"--json",
+	}
+	result, err := execCLI(ctx, bin, req.Dir, args)
+	if result != nil {
+		parseCodexEvents(result)
+	}
+	return result, err
+}
+
+// codexEvent is one line of `codex exec --json` output.
+type codexEvent struct {
+	Type string `json:"type"`
+	Item struct {
+		Type string `json:"type"`
+		Text string `json:"text"`
+	} `json:"item"`
+	Usage struct {
+		InputTokens       int `json:"input_tokens"`
+		CachedInputTokens int `json:"cached_input_tokens"`
+		OutputTokens      int `json:"output_tokens"`
+	} `json:"usage"`
+}
+
+// parseCodexEvents sums usage over all turns and keeps the last agent
+// message as the output. Output without any events is left as is.
+func parseCodexEvents(result *Result) {
+	usage := &Usage{}
+	var message string
+	events := 0
+	for _, line := range strings.Split(result.Output, "\n") {
+		var ev codexEvent
+		if json.Unmarshal([]byte(line), &ev) != nil || ev.Type == "" {
+			continue
+		}
+		events++
+		switch ev.Type {
+		case "turn.completed":
+			usage.Turns++
+			usage.InputTokens += ev.Usage.InputTokens - ev.Usage.CachedInputTokens
+			usage.CacheReadTokens += ev.Usage.CachedInputTokens
+			usage.OutputTokens += ev.Usage.OutputTokens
+		case "item.completed":
+			if ev.Item.Type == "agent_message" {
+				message = ev.Item.Text
+			}
+		}
+	}
+	if events == 0 {
+		return
+	}
+	result.Output = message
+	result.Usage = usage
+}
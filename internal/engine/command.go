@@ -0,0 +1,97 @@
+package engine
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+	"text/template"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+// CommandVars are the placeholders available in a command template.
+type CommandVars struct {
+	Prompt   string
+	GitRoot  string
+	WikiPath string
+	Model    string
+	MaxTurns int
+}
+
+// command is an engine defined entirely in config.json by an argv template,
+// e.g. ["aider", "--message", "{{.Prompt}}", "--yes"]. Each element is a
+// text/template; elements that expand to an empty string are dropped so
+// optional flags can be written as "{{if .Model}}--model={{.Model}}{{end}}".
+type command struct {
+	name string
+	argv []string
+}
+
+func (c command) Name() string { return c.name }
+
+func (c command) Capabilities() Capabilities {
+	joined := strings.Join(c.argv, " ")
+	return Capabilities{
+		Model:    strings.Contains(joined, ".Model"),
+		MaxTurns: strings.Contains(joined, ".MaxTurns"),
+	}
+}
+
+func (c command) Detect(cfg *config.Config) (string, error) {
+	if cfg.EnginePath != "" {
+		if _, err := os.Stat(cfg.EnginePath); err == nil {
+			return cfg.EnginePath, nil
+		}
+	}
+	path, err := exec.LookPath(c.argv[0])
+	if err != nil {
+		return "", fmt.Errorf("%s %w; install it or fix engines.%s.command in config", c.argv[0], ErrNotInstalled, c.name)
+	}
+	return path, nil
+}
+
+func (c command) Version(cfg *config.Config) (string, error) {
+	bin, err := c.Detect(cfg)
+	if err != nil {
+		return "", err
+	}
+	return binaryVersion(bin)
+}
+
+func (c command) Run(ctx context.Context, cfg *config.Config, req *Request) (*Result, error) {
+	bin, err := c.Detect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	args, err := expandArgs(c.argv[1:], CommandVars{
+		Prompt:   req.Prompt,
+		GitRoot:  req.Dir,
+		WikiPath: cfg.WikiPath,
+		Model:    req.Model,
+		MaxTurns: req.MaxTurns,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("engines.%s.command: %w", c.name, err)
+	}
+	return execCLI(ctx, bin, req.Dir, args)
+}
+
+func expandArgs(templates []string, vars CommandVars) ([]string, error) {
+	args := make([]string, 0, len(templates))
+	for _, t := range templates {
+		tmpl, err := template.New("arg").Option("missingkey=error").Parse(t)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		if err := tmpl.Execute(&b, vars); err != nil {
+			return nil, err
+		}
+		if b.Len() > 0 {
+			args = append(args, b.String())
+		}
+	}
+	return args, nil
+}
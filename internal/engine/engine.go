@@ -0,0 +1,220 @@
+package engine
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+// Engine is an AI backend capable of editing the wiki in a repository.
+type Engine interface {
+	// Name is the value used for the "engine" field in config.json.
+	Name() string
+	// Detect locates the engine on this machine and returns its binary path.
+	Detect(cfg *config.Config) (string, error)
+	// Version reports the installed engine version.
+	Version(cfg *config.Config) (string, error)
+	// Run invokes the engine non-interactively with the given request. It
+	// must stop promptly when ctx is done. On failure it may return a
+	// partial Result alongside the error.
+	Run(ctx context.Context, cfg *config.Config, req *Request) (*Result, error)
+	// Capabilities describes which request fields the engine honours.
+	Capabilities() Capabilities
+}
+
+// Request is a single engine invocation.
+type Request struct {
+	Prompt   string
+	Dir      string
+	Model    string
+	MaxTurns int
+}
+
+// Result is the outcome of an engine invocation.
+type Result struct {
+	Engine string // engine that produced the result
+	Model  string
+	Output string
+	Stderr string
+	Argv   []string // command line, for engines that run a subprocess
+	Usage  *Usage   // nil if the engine does not report usage
+}
+
+// Usage is the consumption reported by an engine. Fields an engine doesn't
+// report are zero.
+type Usage struct {
+	InputTokens         int     `json:"input_tokens"`
+	OutputTokens        int     `json:"output_tokens"`
+	CacheReadTokens     int     `json:"cache_read_tokens,omitempty"`
+	CacheCreationTokens int     `json:"cache_creation_tokens,omitempty"`
+	Turns               int     `json:"turns,omitempty"`
+	CostUSD             float64 `json:"cost_usd,omitempty"`
+}
+
+// Add adds o's counts and cost to u. A nil o adds nothing.
+func (u *Usage) Add(o *Usage) {
+	if o == nil {
+		return
+	}
+	u.InputTokens += o.InputTokens
+	u.OutputTokens += o.OutputTokens
+	u.CacheReadTokens += o.CacheReadTokens
+	u.CacheCreationTokens += o.CacheCreationTokens
+	u.Turns += o.Turns
+	u.CostUSD += o.CostUSD
+}
+
+// TotalTokens is the sum of all token counts.
+func (u *Usage) TotalTokens() int {
+	return u.InputTokens + u.OutputTokens + u.CacheReadTokens + u.CacheCreationTokens
+}
+
+// Capabilities describes optional engine features.
+type Capabilities struct {
+	Model    bool // Request.Model is passed to the engine
+	MaxTurns bool // Request.MaxTurns is passed to the engine
+	Manual   bool // never picked by auto-detection; must be chosen explicitly
+}
+
+// ErrTimeout is returned by Run when the engine exceeds its timeout.
+var ErrTimeout = errors.New("engine timed out")
+
+var (
+	mu       sync.RWMutex
+	registry = map[string]Engine{}
+	order    []string
+)
+
+// Register makes an engine available under its name. Engines registered
+// earlier are preferred during auto-detection. Registering a name twice panics.
+func Register(e Engine) {
+	mu.Lock()
+	defer mu.Unlock()
+	name := e.Name()
+	if _, dup := registry[name]; dup {
+		panic("engine: Register called twice for " + name)
+	}
+	registry[name] = e
+	order = append(order, name)
+}
+
+// Get returns the engine registered under name, falling back to an external
+// plugin on $PATH. Registered engines take precedence over plugins.
+func Get(name string) (Engine, error) {
+	if e, ok := registered(name); ok {
+		return e, nil
+	}
+	if e, ok := lookupPlugin(name); ok {
+		return e, nil
+	}
+	return nil, fmt.Errorf("%w: %s (valid: %s)", ErrUnknownEngine, name, strings.Join(Names(), ", "))
+}
+
+// Resolve is like Get but also sees the command-template engines defined
+// under cfg.Engines, which take precedence over plugins of the same name.
+func Resolve(cfg *config.Config, name string) (Engine, error) {
+	if e, ok := registered(name); ok {
+		return e, nil
+	}
+	if argv := cfg.SettingsFor(name).Command; len(argv) > 0 {
+		return command{name: name, argv: argv}, nil
+	}
+	if e, ok := lookupPlugin(name); ok {
+		return e, nil
+	}
+	return nil, fmt.Errorf("%w: %s (valid: %s)", ErrUnknownEngine, name, strings.Join(ConfiguredNames(cfg), ", "))
+}
+
+func registered(name string) (Engine, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	e, ok := registry[name]
+	return e, ok
+}
+
+// ConfiguredNames returns Names plus the command engines defined in cfg.
+func ConfiguredNames(cfg *config.Config) []string {
+	names := Names()
+	for name, s := range cfg.Engines {
+		if len(s.Command) > 0 && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Names returns all registered and plugin engine names in alphabetical order.
+func Names() []string {
+	mu.RLock()
+	names := make([]string, 0, len(registry))
+	for name := range registry {
+		names = append(names, name)
+	}
+	mu.RUnlock()
+	for _, name := range pluginNames() {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// DetectOrder returns engine names in the order they are tried during
+// auto-detection: registered engines first, then plugins found on $PATH.
+func DetectOrder() []string {
+	mu.RLock()
+	var names []string
+	for _, name := range order {
+		if !registry[name].Capabilities().Manual {
+			names = append(names, name)
+		}
+	}
+	mu.RUnlock()
+	for _, name := range pluginNames() {
+		if !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Run looks up the configured engine and invokes it with the given prompt,
+// enforcing the engine's configured timeout.
+func Run(ctx context.Context, cfg *config.Config, dir string, prompt string) (*Result, error) {
+	e, err := Resolve(cfg, cfg.Engine)
+	if err != nil {
+		return nil, err
+	}
+	if timeout := cfg.EngineTimeout(cfg.Engine); timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+	result, err := e.Run(ctx, cfg, &Request{
+		Prompt:   prompt,
+		Dir:      dir,
+		Model:    cfg.Model,
+		MaxTurns: cfg.MaxTurns,
+	})
+	if result != nil {
+		result.Engine = cfg.Engine
+		result.Model = cfg.Model
+		if u := result.Usage; u != nil && u.CostUSD == 0 {
+			s := cfg.SettingsFor(cfg.Engine)
+			u.CostUSD = (float64(u.InputTokens+u.CacheReadTokens+u.CacheCreationTokens)*s.InputPrice +
+				float64(u.OutputTokens)*s.OutputPrice) / 1_000_000
+		}
+	}
+	if err != nil && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return result, fmt.Errorf("%s %w after %s", cfg.Engine, ErrTimeout, cfg.EngineTimeout(cfg.Engine))
+	}
+	return result, err
+}
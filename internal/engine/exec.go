@@ -0,0 +1,108 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+// findBinary resolves an engine binary: engine_path from config, then $PATH,
+// then a list of well-known install locations.
+func findBinary(cfg *config.Config, name string, knownPaths []string, hint string) (string, error) {
+	if cfg.EnginePath != "" {
+		if _, err := os.Stat(cfg.EnginePath); err == nil {
+			return cfg.EnginePath, nil
+		}
+	}
+	if path, err := exec.LookPath(name); err == nil {
+		return path, nil
+	}
+	for _, p := range knownPaths {
+		if _, err := os.Stat(p); err == nil {
+			return p, nil
+		}
+	}
+	return "", fmt.Errorf("%s %w; %s or set engine_path in config", name, ErrNotInstalled, hint)
+}
+
+// binaryVersion runs `<bin> --version` and returns the first line of output.
+func binaryVersion(bin string) (string, error) {
+	out, err := exec.Command(bin, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("%s --version: %w", bin, err)
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(out)), "\n")
+	return line, nil
+}
+
+type startHookKey struct{}
+
+// WithStartHook returns a context that makes subprocess engines call fn with
+// their PID, which is also their process group ID, right after starting.
+func WithStartHook(ctx context.Context, fn func(pid int)) context.Context {
+	return context.WithValue(ctx, startHookKey{}, fn)
+}
+
+// execCLI runs an engine binary in dir. The returned Result is non-nil even
+// on failure so callers can inspect the captured output.
+func execCLI(ctx context.Context, bin string, dir string, args []string) (*Result, error) {
+	return runCommand(ctx, bin, dir, args, nil)
+}
+
+// engineEnv is the process environment without GIT_INDEX_FILE. A run
+// started from a git hook inherits it as a path relative to the checkout;
+// git commands the engine runs in a sandbox worktree would resolve it
+// there, and in the checkout the engine has no business with the index.
+func engineEnv() []string {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "GIT_INDEX_FILE=") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
+
+// runCommand runs bin in its own process group so that cancelling ctx kills
+// the engine together with any tools or sub-agents it spawned.
+func runCommand(ctx context.Context, bin string, dir string, args []string, stdin io.Reader) (*Result, error) {
+	cmd := exec.CommandContext(ctx, bin, args...)
+	cmd.Dir = dir
+	cmd.Env = engineEnv()
+	cmd.Stdin = stdin
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	cmd.Cancel = func() error {
+		return syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+	}
+	// Don't wait forever on pipes held open by orphaned grandchildren.
+	cmd.WaitDelay = 5 * time.Second
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Start()
+	if err == nil {
+		if fn, ok := ctx.Value(startHookKey{}).(func(int)); ok {
+			fn(cmd.Process.Pid)
+		}
+		err = cmd.Wait()
+	}
+	result := &Result{
+		Output: stdout.String(),
+		Stderr: stderr.String(),
+		Argv:   append([]string{bin}, args...),
+	}
+	if err != nil {
+		return result, fmt.Errorf("%s error: %w\nstderr: %s", bin, err, stderr.String())
+	}
+	return result, nil
+}
@@ -0,0 +1,188 @@
+package engine
+
+import (
+	"bufio"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// FakeFailEnv makes the fake engine fail with the variable's value as stderr,
+// for exercising error handling without a real engine.
+const FakeFailEnv = "REPOWIKI_FAKE_FAIL"
+
+// fake is a deterministic, offline engine for dry runs and tests. Instead of
+// calling an AI it writes one page per changed source file listed in the
+// prompt, plus matching metadata. Full generation (no file list) writes an
+// overview page and a page for every tracked file. The same prompt against
+// the same tree always produces the same wiki.
+type fake struct{}
+
+func (fake) Name() string { return config.EngineFake }
+
+func (fake) Capabilities() Capabilities {
+	return Capabilities{Manual: true}
+}
+
+func (fake) Detect(cfg *config.Config) (string, error) {
+	return "(built-in)", nil
+}
+
+func (fake) Version(cfg *config.Config) (string, error) {
+	return "fake", nil
+}
+
+type fakeSnippet struct {
+	ID        string `json:"id"`
+	Path      string `json:"path"`
+	LineRange string `json:"line_range"`
+}
+
+type fakeMetadata struct {
+	CodeSnippets []fakeSnippet `json:"code_snippets"`
+}
+
+func (fake) Run(ctx context.Context, cfg *config.Config, req *Request) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	if msg := os.Getenv(FakeFailEnv); msg != "" {
+		return nil, fmt.Errorf("fake engine error: exit status 1\nstderr: %s", msg)
+	}
+
+	langDir := filepath.Join(req.Dir, cfg.WikiPath, cfg.Language)
+	contentDir := filepath.Join(langDir, "content")
+	metaPath := filepath.Join(langDir, "meta", "repowiki-metadata.json")
+
+	var meta fakeMetadata
+	if data, err := os.ReadFile(metaPath); err == nil {
+		json.Unmarshal(data, &meta)
+	}
+	snippets := map[string]fakeSnippet{}
+	for _, s := range meta.CodeSnippets {
+		snippets[s.Path] = s
+	}
+
+	var written []string
+	files := promptChangedFiles(req.Prompt)
+	if files == nil {
+		// Full generation: a single overview page citing every tracked file.
+		tracked, err := git.TrackedFiles(req.Dir)
+		if err != nil {
+			return nil, err
+		}
+		files = excludePrefix(tracked, filepath.ToSlash(cfg.WikiPath)+"/")
+		snippets = map[string]fakeSnippet{}
+		page := "System Overview.md"
+		if err := writeFakePage(filepath.Join(contentDir, page), "System Overview", files); err != nil {
+			return nil, err
+		}
+		written = append(written, page)
+	}
+
+	for _, f := range files {
+		lines, err := countLines(filepath.Join(req.Dir, f))
+		page := filepath.Join("Files", f+".md")
+		if err != nil {
+			// Deleted source file: drop its page and snippet.
+			os.Remove(filepath.Join(contentDir, page))
+			delete(snippets, f)
+			continue
+		}
+		sum := md5.Sum([]byte(f))
+		snippets[f] = fakeSnippet{ID: hex.EncodeToString(sum[:]), Path: f, LineRange: fmt.Sprintf("1-%d", lines)}
+		if err := writeFakePage(filepath.Join(contentDir, page), f, []string{f}); err != nil {
+			return nil, err
+		}
+		written = append(written, page)
+	}
+
+	meta.CodeSnippets = meta.CodeSnippets[:0]
+	for _, s := range snippets {
+		meta.CodeSnippets = append(meta.CodeSnippets, s)
+	}
+	sort.Slice(meta.CodeSnippets, func(i, j int) bool {
+		return meta.CodeSnippets[i].Path < meta.CodeSnippets[j].Path
+	})
+	data, err := json.MarshalIndent(meta, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := os.MkdirAll(filepath.Dir(metaPath), 0755); err != nil {
+		return nil, err
+	}
+	if err := os.WriteFile(metaPath, append(data, '\n'), 0644); err != nil {
+		return nil, err
+	}
+
+	return &Result{
+		Output: "fake engine wrote:\n" + strings.Join(written, "\n") + "\n",
+		Usage:  &Usage{InputTokens: len(req.Prompt) / 4, OutputTokens: 100 * len(written), Turns: 1},
+	}, nil
+}
+
+// promptChangedFiles extracts the list under "CHANGED SOURCE FILES:" from an
+// incremental prompt. It returns nil for prompts without that section.
+func promptChangedFiles(prompt string) []string {
+	_, rest, ok := strings.Cut(prompt, "CHANGED SOURCE FILES:\n")
+	if !ok {
+		return nil
+	}
+	files := []string{}
+	for _, line := range strings.Split(rest, "\n") {
+		f, ok := strings.CutPrefix(line, "  - ")
+		if !ok {
+			break
+		}
+		files = append(files, f)
+	}
+	return files
+}
+
+func writeFakePage(path string, title string, sources []string) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# %s\n\n<cite>\n", title)
+	for _, s := range sources {
+		fmt.Fprintf(&b, "- [%s](file://%s)\n", filepath.Base(s), s)
+	}
+	b.WriteString("</cite>\n\n## Table of Contents\n1. [Summary](#summary)\n\n## Summary\n\n")
+	fmt.Fprintf(&b, "Placeholder page generated by the fake engine for %d source file(s).\n", len(sources))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, []byte(b.String()), 0644)
+}
+
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	n := 0
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		n++
+	}
+	return n, nil
+}
+
+func excludePrefix(files []string, prefix string) []string {
+	var out []string
+	for _, f := range files {
+		if !strings.HasPrefix(f, prefix) {
+			out = append(out, f)
+		}
+	}
+	return out
+}
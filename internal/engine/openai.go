@@ -0,0 +1,193 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+const (
+	defaultOpenAIBaseURL   = "http://localhost:11434/v1" // Ollama
+	defaultOpenAIAPIKeyEnv = "OPENAI_API_KEY"
+)
+
+const openAISystemPrompt = `You are an autonomous documentation agent working inside a git repository.
+Use the provided tools to inspect source files and to create or edit wiki pages.
+Paths are relative to the repository root. Files can only be written inside %s/.
+When the wiki is up to date, reply with a short summary and no tool calls.`
+
+// openAICompatible talks to any chat-completions endpoint (Ollama,
+// llama.cpp server, vLLM, ...) and runs the agent tool loop in-process.
+type openAICompatible struct{}
+
+func (openAICompatible) Name() string { return config.EngineOpenAICompatible }
+
+func (openAICompatible) Capabilities() Capabilities {
+	return Capabilities{Model: true, MaxTurns: true}
+}
+
+func openAIBaseURL(cfg *config.Config) string {
+	if u := cfg.SettingsFor(config.EngineOpenAICompatible).BaseURL; u != "" {
+		return strings.TrimRight(u, "/")
+	}
+	return defaultOpenAIBaseURL
+}
+
+func openAIAPIKey(cfg *config.Config) string {
+	env := cfg.SettingsFor(config.EngineOpenAICompatible).APIKeyEnv
+	if env == "" {
+		env = defaultOpenAIAPIKeyEnv
+	}
+	return os.Getenv(env)
+}
+
+// Detect checks that the endpoint answers GET /models and returns its URL.
+func (openAICompatible) Detect(cfg *config.Config) (string, error) {
+	base := openAIBaseURL(cfg)
+	req, err := http.NewRequest(http.MethodGet, base+"/models", nil)
+	if err != nil {
+		return "", err
+	}
+	if key := openAIAPIKey(cfg); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+	client := &http.Client{Timeout: 3 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("openai-compatible endpoint %s unreachable; set engines.%s.base_url in config", base, config.EngineOpenAICompatible)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("openai-compatible endpoint %s: GET /models returned %s", base, resp.Status)
+	}
+	return base, nil
+}
+
+func (openAICompatible) Version(cfg *config.Config) (string, error) {
+	return "", nil
+}
+
+type chatMessage struct {
+	Role       string     `json:"role"`
+	Content    string     `json:"content"`
+	ToolCalls  []toolCall `json:"tool_calls,omitempty"`
+	ToolCallID string     `json:"tool_call_id,omitempty"`
+}
+
+type toolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type chatRequest struct {
+	Model    string        `json:"model"`
+	Messages []chatMessage `json:"messages"`
+	Tools    []toolSpec    `json:"tools"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	} `json:"choices"`
+	Usage struct {
+		PromptTokens     int `json:"prompt_tokens"`
+		CompletionTokens int `json:"completion_tokens"`
+	} `json:"usage"`
+}
+
+func (o openAICompatible) Run(ctx context.Context, cfg *config.Config, req *Request) (*Result, error) {
+	if req.Model == "" {
+		return nil, fmt.Errorf("%s engine requires a model; set \"model\" in config", config.EngineOpenAICompatible)
+	}
+	tools := newToolbox(req.Dir, cfg.WikiPath)
+	messages := []chatMessage{
+		{Role: "system", Content: fmt.Sprintf(openAISystemPrompt, cfg.WikiPath)},
+		{Role: "user", Content: req.Prompt},
+	}
+	usage := &Usage{}
+
+	maxTurns := req.MaxTurns
+	if maxTurns <= 0 {
+		maxTurns = config.Default().MaxTurns
+	}
+	for turn := 0; turn < maxTurns; turn++ {
+		resp, err := o.complete(ctx, cfg, &chatRequest{Model: req.Model, Messages: messages, Tools: toolSpecs})
+		if err != nil {
+			return &Result{Usage: usage}, err
+		}
+		usage.Turns++
+		usage.InputTokens += resp.Usage.PromptTokens
+		usage.OutputTokens += resp.Usage.CompletionTokens
+		if len(resp.Choices) == 0 {
+			return &Result{Usage: usage}, fmt.Errorf("openai-compatible: response contained no choices")
+		}
+
+		msg := resp.Choices[0].Message
+		messages = append(messages, msg)
+		if len(msg.ToolCalls) == 0 {
+			return &Result{Output: msg.Content, Usage: usage}, nil
+		}
+		for _, call := range msg.ToolCalls {
+			messages = append(messages, chatMessage{
+				Role:       "tool",
+				ToolCallID: call.ID,
+				Content:    tools.call(call.Function.Name, call.Function.Arguments),
+			})
+		}
+	}
+	return &Result{Usage: usage}, fmt.Errorf("openai-compatible: max turns (%d) reached", maxTurns)
+}
+
+func (openAICompatible) complete(ctx context.Context, cfg *config.Config, body *chatRequest) (*chatResponse, error) {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode chat request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, openAIBaseURL(cfg)+"/chat/completions", bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if key := openAIAPIKey(cfg); key != "" {
+		req.Header.Set("Authorization", "Bearer "+key)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("openai-compatible request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	raw, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("openai-compatible: reading response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("openai-compatible: %s: %s", resp.Status, truncate(string(raw), 500))
+	}
+	var out chatResponse
+	if err := json.Unmarshal(raw, &out); err != nil {
+		return nil, fmt.Errorf("openai-compatible: invalid response: %w", err)
+	}
+	return &out, nil
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
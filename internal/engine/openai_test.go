@@ -0,0 +1,176 @@
+package engine
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+// stubChat serves scripted chat-completions responses, one per request,
+// and records the requests it got.
+type stubChat struct {
+	mu        sync.Mutex
+	responses []chatResponse
+	requests  []chatRequest
+}
+
+func (s *stubChat) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var req chatRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	s.requests = append(s.requests, req)
+	if len(s.responses) == 0 {
+		http.Error(w, "no more scripted responses", http.StatusInternalServerError)
+		return
+	}
+	resp := s.responses[0]
+	s.responses = s.responses[1:]
+	json.NewEncoder(w).Encode(resp)
+}
+
+func reply(content string, calls ...toolCall) chatResponse {
+	var resp chatResponse
+	resp.Choices = make([]struct {
+		Message      chatMessage `json:"message"`
+		FinishReason string      `json:"finish_reason"`
+	}, 1)
+	resp.Choices[0].Message = chatMessage{Role: "assistant", Content: content, ToolCalls: calls}
+	resp.Usage.PromptTokens = 100
+	resp.Usage.CompletionTokens = 10
+	return resp
+}
+
+func call(id string, name string, args map[string]any) toolCall {
+	data, _ := json.Marshal(args)
+	var c toolCall
+	c.ID = id
+	c.Type = "function"
+	c.Function.Name = name
+	c.Function.Arguments = string(data)
+	return c
+}
+
+func TestOpenAICompatibleToolLoop(t *testing.T) {
+	root := t.TempDir()
+	outside := t.TempDir()
+	mustWrite(t, filepath.Join(root, "main.go"), "package main\n")
+	mustWrite(t, filepath.Join(root, "wiki", "index.md"), "# Index\n\nold text\n")
+	mustWrite(t, filepath.Join(outside, "secret.txt"), "secret\n")
+	mustSymlink(t, filepath.Join(root, "main.go"), filepath.Join(root, "wiki", "source.md"))
+	mustSymlink(t, outside, filepath.Join(root, "wiki", "escape"))
+	mustSymlink(t, filepath.Join(outside, "secret.txt"), filepath.Join(root, "leak.txt"))
+
+	stub := &stubChat{responses: []chatResponse{
+		reply("", call("1", "Read", map[string]any{"path": "main.go"}),
+			call("2", "Write", map[string]any{"path": "wiki/content/overview.md", "content": "# Overview\n"}),
+			call("3", "Edit", map[string]any{"path": "wiki/index.md", "old_string": "old text", "new_string": "new text"}),
+			call("4", "Glob", map[string]any{"pattern": "**/*.md"})),
+		reply("", call("5", "Write", map[string]any{"path": "main.go", "content": "package evil\n"}),
+			call("6", "Write", map[string]any{"path": "../evil.md", "content": "x"}),
+			call("7", "Write", map[string]any{"path": "wiki/source.md", "content": "package evil\n"}),
+			call("8", "Write", map[string]any{"path": "wiki/escape/sub/page.md", "content": "x"}),
+			call("9", "Read", map[string]any{"path": "leak.txt"}),
+			call("10", "Grep", map[string]any{"pattern": "secret"})),
+		reply("wiki updated"),
+	}}
+	srv := httptest.NewServer(stub)
+	defer srv.Close()
+
+	cfg := config.Default()
+	cfg.WikiPath = "wiki"
+	cfg.Engines = map[string]config.EngineSettings{
+		config.EngineOpenAICompatible: {BaseURL: srv.URL},
+	}
+	res, err := openAICompatible{}.Run(context.Background(), cfg, &Request{Prompt: "update", Dir: root, Model: "stub", MaxTurns: 5})
+	if err != nil {
+		t.Fatalf("Run: %v", err)
+	}
+	if res.Output != "wiki updated" {
+		t.Errorf("Output = %q, want %q", res.Output, "wiki updated")
+	}
+	if res.Usage.Turns != 3 || res.Usage.InputTokens != 300 || res.Usage.OutputTokens != 30 {
+		t.Errorf("Usage = %+v, want 3 turns, 300 input and 30 output tokens", *res.Usage)
+	}
+
+	assertFile(t, filepath.Join(root, "wiki", "content", "overview.md"), "# Overview\n")
+	assertFile(t, filepath.Join(root, "wiki", "index.md"), "# Index\n\nnew text\n")
+	assertFile(t, filepath.Join(root, "main.go"), "package main\n")
+	if _, err := os.Stat(filepath.Join(outside, "sub")); !os.IsNotExist(err) {
+		t.Errorf("write through symlinked directory created %s", filepath.Join(outside, "sub"))
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "evil.md")); !os.IsNotExist(err) {
+		t.Errorf("write outside the repository succeeded")
+	}
+
+	results := toolResults(stub.requests)
+	for id, want := range map[string]string{
+		"1":  "package main",
+		"2":  "wrote 11 bytes",
+		"3":  "1 replacement",
+		"4":  "wiki/content/overview.md",
+		"5":  "outside the wiki directory",
+		"6":  "outside the repository",
+		"7":  "is a symlink",
+		"8":  "resolves outside the wiki directory",
+		"9":  "resolves outside the repository",
+		"10": "no matches",
+	} {
+		if !strings.Contains(results[id], want) {
+			t.Errorf("tool call %s returned %q, want it to contain %q", id, results[id], want)
+		}
+	}
+}
+
+// toolResults maps tool call IDs to the results sent back to the model.
+func toolResults(requests []chatRequest) map[string]string {
+	out := map[string]string{}
+	for _, req := range requests {
+		for _, m := range req.Messages {
+			if m.Role == "tool" {
+				out[m.ToolCallID] = m.Content
+			}
+		}
+	}
+	return out
+}
+
+func mustWrite(t *testing.T, path string, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func mustSymlink(t *testing.T, target string, link string) {
+	t.Helper()
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func assertFile(t *testing.T, path string, want string) {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Errorf("reading %s: %v", path, err)
+		return
+	}
+	if string(data) != want {
+		t.Errorf("%s = %q, want %q", path, data, want)
+	}
+}
@@ -0,0 +1,153 @@
+package engine
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+// PluginPrefix is the executable name prefix for external engines. Any
+// `repowiki-engine-<name>` binary on $PATH is usable as engine "<name>".
+//
+// Plugins speak a one-shot JSON protocol. repowiki writes a PluginRequest to
+// the plugin's stdin, runs it with the git root as working directory, and
+// reads a single PluginResponse from stdout. Stderr is passed through to the
+// log on failure. `repowiki-engine-<name> --version` should print a version.
+const PluginPrefix = "repowiki-engine-"
+
+// PluginRequest is written to a plugin's stdin.
+type PluginRequest struct {
+	Prompt   string `json:"prompt"`
+	Dir      string `json:"dir"`
+	Model    string `json:"model,omitempty"`
+	MaxTurns int    `json:"max_turns,omitempty"`
+}
+
+// PluginResponse is read from a plugin's stdout.
+type PluginResponse struct {
+	Status string `json:"status"` // "ok" or "error"
+	Output string `json:"output,omitempty"`
+	Error  string `json:"error,omitempty"`
+	Usage  *Usage `json:"usage,omitempty"`
+}
+
+// plugin is an external engine discovered on $PATH.
+type plugin struct {
+	name string
+	path string
+}
+
+func (p plugin) Name() string { return p.name }
+
+func (plugin) Capabilities() Capabilities {
+	return Capabilities{Model: true, MaxTurns: true}
+}
+
+func (p plugin) Detect(cfg *config.Config) (string, error) {
+	if cfg.EnginePath != "" {
+		if _, err := os.Stat(cfg.EnginePath); err == nil {
+			return cfg.EnginePath, nil
+		}
+	}
+	if p.path != "" {
+		return p.path, nil
+	}
+	if path, err := exec.LookPath(PluginPrefix + p.name); err == nil {
+		return path, nil
+	}
+	return "", fmt.Errorf("%s%s %w on PATH", PluginPrefix, p.name, ErrNotInstalled)
+}
+
+func (p plugin) Version(cfg *config.Config) (string, error) {
+	bin, err := p.Detect(cfg)
+	if err != nil {
+		return "", err
+	}
+	return binaryVersion(bin)
+}
+
+func (p plugin) Run(ctx context.Context, cfg *config.Config, req *Request) (*Result, error) {
+	bin, err := p.Detect(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	input, err := json.Marshal(PluginRequest{
+		Prompt:   req.Prompt,
+		Dir:      req.Dir,
+		Model:    req.Model,
+		MaxTurns: req.MaxTurns,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode plugin request: %w", err)
+	}
+
+	result, err := runCommand(ctx, bin, req.Dir, nil, bytes.NewReader(input))
+	if err != nil {
+		return result, err
+	}
+
+	var resp PluginResponse
+	if err := json.Unmarshal([]byte(result.Output), &resp); err != nil {
+		return result, fmt.Errorf("%s returned invalid response: %w", bin, err)
+	}
+	if resp.Status != "ok" {
+		msg := resp.Error
+		if msg == "" {
+			msg = "status " + resp.Status
+		}
+		return result, fmt.Errorf("%s failed: %s", bin, msg)
+	}
+	result.Output = resp.Output
+	result.Usage = resp.Usage
+	return result, nil
+}
+
+// lookupPlugin returns the plugin engine for name if its binary is on $PATH.
+func lookupPlugin(name string) (Engine, bool) {
+	if name == "" || strings.ContainsRune(name, filepath.Separator) {
+		return nil, false
+	}
+	path, err := exec.LookPath(PluginPrefix + name)
+	if err != nil {
+		return nil, false
+	}
+	return plugin{name: name, path: path}, true
+}
+
+// pluginNames scans $PATH for plugin executables, sorted by name.
+// Earlier $PATH entries shadow later ones, matching exec.LookPath.
+func pluginNames() []string {
+	seen := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("PATH")) {
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			name, ok := strings.CutPrefix(e.Name(), PluginPrefix)
+			if !ok || name == "" || e.IsDir() {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil || info.Mode()&0111 == 0 {
+				continue
+			}
+			seen[name] = true
+		}
+	}
+	names := make([]string, 0, len(seen))
+	for name := range seen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
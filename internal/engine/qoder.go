@@ -0,0 +1,56 @@
+package engine
+
+import (
+	"context"
+	"runtime"
+	"strconv"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+// qoder drives the Qoder CLI (qodercli).
+type qoder struct{}
+
+func (qoder) Name() string { return config.EngineQoder }
+
+func (qoder) Capabilities() Capabilities {
+	return Capabilities{Model: true, MaxTurns: true}
+}
+
+func (qoder) Detect(cfg *config.Config) (string, error) {
+	var known []string
+	if runtime.GOOS == "darwin" {
+		known = []string{
+			"/Applications/Qoder.app/Contents/Resources/app/resources/bin/aarch64_darwin/qodercli",
+			"/Applications/Qoder.app/Contents/Resources/app/resources/bin/x86_64_darwin/qodercli",
+		}
+	}
+	return findBinary(cfg, "qodercli", known, "install Qoder")
+}
+
+func (q qoder) Version(cfg *config.Config) (string, error) {
+	bin, err := q.Detect(cfg)
+	if err != nil {
+		return "", err
+	}
+	return binaryVersion(bin)
+}
+
+func (q qoder) Run(ctx context.Context, cfg *config.Config, req *Request) (*Result, error) {
+	bin, err := q.Detect(cfg)
+	if err != nil {
+		return nil, err
+	}
+	args := []string{
+		"-p", req.Prompt,
+		"-q",
+		"-w", req.Dir,
+		"--max-turns", strconv.Itoa(req.MaxTurns),
+		"--dangerously-skip-permissions",
+		"--allowed-tools", "Read,Write,Edit,Glob,Grep,Bash",
+	}
+	if req.Model != "" {
+		args = append(args, "--model", req.Model)
+	}
+	return execCLI(ctx, bin, req.Dir, args)
+}
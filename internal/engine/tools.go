@@ -0,0 +1,384 @@
+package engine
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const (
+	maxReadBytes   = 256 * 1024
+	maxGlobResults = 500
+	maxGrepResults = 200
+)
+
+// toolSpec is a function tool definition in chat-completions format.
+type toolSpec struct {
+	Type     string       `json:"type"`
+	Function toolFunction `json:"function"`
+}
+
+type toolFunction struct {
+	Name        string         `json:"name"`
+	Description string         `json:"description"`
+	Parameters  map[string]any `json:"parameters"`
+}
+
+func objectSchema(required []string, props map[string]any) map[string]any {
+	return map[string]any{"type": "object", "properties": props, "required": required}
+}
+
+var (
+	strProp  = map[string]any{"type": "string"}
+	intProp  = map[string]any{"type": "integer"}
+	boolProp = map[string]any{"type": "boolean"}
+)
+
+var toolSpecs = []toolSpec{
+	{Type: "function", Function: toolFunction{
+		Name:        "Read",
+		Description: "Read a text file. Optional offset (1-based line) and limit (line count).",
+		Parameters:  objectSchema([]string{"path"}, map[string]any{"path": strProp, "offset": intProp, "limit": intProp}),
+	}},
+	{Type: "function", Function: toolFunction{
+		Name:        "Write",
+		Description: "Create or overwrite a file inside the wiki directory.",
+		Parameters:  objectSchema([]string{"path", "content"}, map[string]any{"path": strProp, "content": strProp}),
+	}},
+	{Type: "function", Function: toolFunction{
+		Name:        "Edit",
+		Description: "Replace old_string with new_string in a wiki file. old_string must be unique unless replace_all is true.",
+		Parameters: objectSchema([]string{"path", "old_string", "new_string"}, map[string]any{
+			"path": strProp, "old_string": strProp, "new_string": strProp, "replace_all": boolProp,
+		}),
+	}},
+	{Type: "function", Function: toolFunction{
+		Name:        "Glob",
+		Description: "List files matching a glob pattern such as **/*.go, relative to the repository root.",
+		Parameters:  objectSchema([]string{"pattern"}, map[string]any{"pattern": strProp}),
+	}},
+	{Type: "function", Function: toolFunction{
+		Name:        "Grep",
+		Description: "Search file contents with a regular expression. Optional glob restricts which files are searched.",
+		Parameters:  objectSchema([]string{"pattern"}, map[string]any{"pattern": strProp, "glob": strProp}),
+	}},
+}
+
+// toolbox executes tool calls. Reads are confined to the repository root and
+// writes to the wiki directory.
+type toolbox struct {
+	root     string
+	wikiPath string
+}
+
+func newToolbox(root string, wikiPath string) *toolbox {
+	return &toolbox{root: root, wikiPath: filepath.Clean(wikiPath)}
+}
+
+// call runs a tool and returns its textual result. Errors are returned as
+// text so the model can see and recover from them.
+func (t *toolbox) call(name string, rawArgs string) string {
+	var args struct {
+		Path       string `json:"path"`
+		Offset     int    `json:"offset"`
+		Limit      int    `json:"limit"`
+		Content    string `json:"content"`
+		OldString  string `json:"old_string"`
+		NewString  string `json:"new_string"`
+		ReplaceAll bool   `json:"replace_all"`
+		Pattern    string `json:"pattern"`
+		Glob       string `json:"glob"`
+	}
+	if err := json.Unmarshal([]byte(rawArgs), &args); err != nil {
+		return "error: invalid arguments: " + err.Error()
+	}
+
+	var out string
+	var err error
+	switch name {
+	case "Read":
+		out, err = t.read(args.Path, args.Offset, args.Limit)
+	case "Write":
+		out, err = t.write(args.Path, args.Content)
+	case "Edit":
+		out, err = t.edit(args.Path, args.OldString, args.NewString, args.ReplaceAll)
+	case "Glob":
+		out, err = t.glob(args.Pattern)
+	case "Grep":
+		out, err = t.grep(args.Pattern, args.Glob)
+	default:
+		err = fmt.Errorf("unknown tool %q", name)
+	}
+	if err != nil {
+		return "error: " + err.Error()
+	}
+	return out
+}
+
+// resolve maps a repository-relative path to an absolute one, rejecting
+// paths that escape the repository root.
+func (t *toolbox) resolve(path string) (abs string, rel string, err error) {
+	rel = filepath.Clean(strings.TrimPrefix(filepath.ToSlash(path), "/"))
+	if filepath.IsAbs(path) {
+		if rel, err = filepath.Rel(t.root, path); err != nil {
+			return "", "", err
+		}
+	}
+	if rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", "", fmt.Errorf("path %s is outside the repository", path)
+	}
+	return filepath.Join(t.root, rel), rel, nil
+}
+
+func (t *toolbox) resolveWritable(path string) (string, error) {
+	abs, rel, err := t.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if rel != t.wikiPath && !strings.HasPrefix(rel, t.wikiPath+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside the wiki directory %s/", path, t.wikiPath)
+	}
+	// Refuse to write through symlinks, which could point out of the wiki.
+	if fi, err := os.Lstat(abs); err == nil && fi.Mode()&fs.ModeSymlink != 0 {
+		return "", fmt.Errorf("path %s is a symlink", path)
+	}
+	if !confined(abs, filepath.Join(t.root, t.wikiPath)) {
+		return "", fmt.Errorf("path %s resolves outside the wiki directory", path)
+	}
+	return abs, nil
+}
+
+// confined reports whether abs stays inside base once symlinks in both are
+// resolved.
+func confined(abs string, base string) bool {
+	real, err := realPath(abs)
+	if err != nil {
+		return false
+	}
+	realBase, err := realPath(base)
+	if err != nil {
+		return false
+	}
+	return real == realBase || strings.HasPrefix(real, realBase+string(filepath.Separator))
+}
+
+// realPath resolves the symlinks in the deepest existing ancestor of abs
+// and appends the rest, so paths that don't exist yet can be checked too.
+// Dangling symlinks are an error, since creating through them would land
+// wherever they point.
+func realPath(abs string) (string, error) {
+	p, rest := abs, ""
+	for {
+		real, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(real, rest), nil
+		}
+		if _, lerr := os.Lstat(p); lerr == nil || !os.IsNotExist(err) {
+			return "", fmt.Errorf("cannot resolve %s: %w", p, err)
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return abs, nil
+		}
+		rest = filepath.Join(filepath.Base(p), rest)
+		p = parent
+	}
+}
+
+func (t *toolbox) read(path string, offset int, limit int) (string, error) {
+	abs, _, err := t.resolve(path)
+	if err != nil {
+		return "", err
+	}
+	if !confined(abs, t.root) {
+		return "", fmt.Errorf("path %s resolves outside the repository", path)
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", err
+	}
+	if len(data) > maxReadBytes {
+		data = data[:maxReadBytes]
+	}
+	if offset <= 0 && limit <= 0 {
+		return string(data), nil
+	}
+	lines := strings.Split(string(data), "\n")
+	start := max(offset-1, 0)
+	if start >= len(lines) {
+		return "", nil
+	}
+	end := len(lines)
+	if limit > 0 && start+limit < end {
+		end = start + limit
+	}
+	return strings.Join(lines[start:end], "\n"), nil
+}
+
+func (t *toolbox) write(path string, content string) (string, error) {
+	abs, err := t.resolveWritable(path)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(abs), 0755); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(abs, []byte(content), 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("wrote %d bytes to %s", len(content), path), nil
+}
+
+func (t *toolbox) edit(path string, oldStr string, newStr string, replaceAll bool) (string, error) {
+	abs, err := t.resolveWritable(path)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(abs)
+	if err != nil {
+		return "", err
+	}
+	content := string(data)
+	n := strings.Count(content, oldStr)
+	switch {
+	case oldStr == "":
+		return "", fmt.Errorf("old_string must not be empty")
+	case n == 0:
+		return "", fmt.Errorf("old_string not found in %s", path)
+	case n > 1 && !replaceAll:
+		return "", fmt.Errorf("old_string occurs %d times in %s; add context or set replace_all", n, path)
+	}
+	replaced := 1
+	if replaceAll {
+		replaced = n
+	}
+	content = strings.Replace(content, oldStr, newStr, replaced)
+	if err := os.WriteFile(abs, []byte(content), 0644); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("edited %s (%d replacement(s))", path, replaced), nil
+}
+
+// walk visits repository files (skipping .git and symlinks, which may point
+// outside the repository) with their slash-separated relative paths.
+func (t *toolbox) walk(fn func(rel string, abs string) bool) error {
+	return filepath.WalkDir(t.root, func(abs string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if d.IsDir() {
+			if d.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if d.Type()&fs.ModeSymlink != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(t.root, abs)
+		if err != nil {
+			return nil
+		}
+		if !fn(filepath.ToSlash(rel), abs) {
+			return fs.SkipAll
+		}
+		return nil
+	})
+}
+
+func (t *toolbox) glob(pattern string) (string, error) {
+	re, err := globRegexp(pattern)
+	if err != nil {
+		return "", err
+	}
+	var matches []string
+	err = t.walk(func(rel string, _ string) bool {
+		if re.MatchString(rel) {
+			matches = append(matches, rel)
+		}
+		return len(matches) < maxGlobResults
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(matches) == 0 {
+		return "no files found", nil
+	}
+	return strings.Join(matches, "\n"), nil
+}
+
+func (t *toolbox) grep(pattern string, glob string) (string, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", err
+	}
+	var filter *regexp.Regexp
+	if glob != "" {
+		if filter, err = globRegexp(glob); err != nil {
+			return "", err
+		}
+	}
+	var results []string
+	err = t.walk(func(rel string, abs string) bool {
+		if filter != nil && !filter.MatchString(rel) && !filter.MatchString(filepath.Base(rel)) {
+			return true
+		}
+		f, err := os.Open(abs)
+		if err != nil {
+			return true
+		}
+		defer f.Close()
+		sc := bufio.NewScanner(f)
+		for n := 1; sc.Scan(); n++ {
+			if re.MatchString(sc.Text()) {
+				results = append(results, fmt.Sprintf("%s:%d: %s", rel, n, sc.Text()))
+				if len(results) >= maxGrepResults {
+					return false
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+	if len(results) == 0 {
+		return "no matches", nil
+	}
+	return strings.Join(results, "\n"), nil
+}
+
+// globRegexp converts a glob with ** support into an anchored regexp over
+// slash-separated paths.
+func globRegexp(pattern string) (*regexp.Regexp, error) {
+	var b strings.Builder
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+			} else {
+				b.WriteString("[^/]*")
+			}
+		case '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return regexp.Compile(b.String())
+}
@@ -1,16 +1,48 @@
 package git
 
 import (
+	"errors"
 	"fmt"
+	"os"
 	"os/exec"
+	"path/filepath"
+	"strconv"
 	"strings"
 )
 
 func run(dir string, args ...string) (string, error) {
+	return runEnv(dir, nil, args...)
+}
+
+// runEnv runs git with extra environment variables such as GIT_INDEX_FILE.
+func runEnv(dir string, env []string, args ...string) (string, error) {
+	if env != nil {
+		env = append(os.Environ(), env...)
+	}
+	return runWith(dir, env, args...)
+}
+
+// runInWorktree runs git in a worktree other than the user's checkout.
+// Git hooks export GIT_INDEX_FILE relative to the checkout, which git would
+// resolve against the other worktree, so it is dropped.
+func runInWorktree(dir string, args ...string) (string, error) {
+	var env []string
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "GIT_INDEX_FILE=") {
+			env = append(env, kv)
+		}
+	}
+	return runWith(dir, env, args...)
+}
+
+// runWith runs git with exactly env as its environment, or the process's
+// own if env is nil.
+func runWith(dir string, env []string, args ...string) (string, error) {
 	cmd := exec.Command("git", args...)
 	if dir != "" {
 		cmd.Dir = dir
 	}
+	cmd.Env = env
 	out, err := cmd.Output()
 	if err != nil {
 		if exitErr, ok := err.(*exec.ExitError); ok {
@@ -33,6 +65,58 @@ func HeadCommit(gitRoot string) (string, error) {
 	return run(gitRoot, "rev-parse", "HEAD")
 }
 
+// IsAncestor reports whether commit a is an ancestor of (or equal to) b.
+// The empty tree, standing for the state before the root commit, is an
+// ancestor of every commit.
+func IsAncestor(gitRoot string, a, b string) bool {
+	cmd := exec.Command("git", "merge-base", "--is-ancestor", a, b)
+	cmd.Dir = gitRoot
+	if cmd.Run() == nil {
+		return true
+	}
+	return a == EmptyTree(gitRoot) && ResolveRef(gitRoot, b) != ""
+}
+
+// EmptyTree returns the hash of the empty tree, which diffs against a
+// commit like the parent its root commit doesn't have, or "" on error.
+func EmptyTree(gitRoot string) string {
+	hash, err := run(gitRoot, "hash-object", "-t", "tree", os.DevNull)
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
+// SameTree reports whether commits a and b have identical trees.
+func SameTree(gitRoot string, a, b string) bool {
+	out, err := run(gitRoot, "rev-parse", a+"^{tree}", b+"^{tree}")
+	if err != nil {
+		return false
+	}
+	trees := strings.Fields(out)
+	return len(trees) == 2 && trees[0] == trees[1]
+}
+
+// IsRewriting reports whether HEAD was just moved by `commit --amend` or a
+// rebase is in progress: the cases git reports to the post-rewrite hook.
+func IsRewriting(gitRoot string) bool {
+	// rebase-apply is also used by `git am`, which marks it "applying".
+	for _, p := range []string{"rebase-merge", "rebase-apply/rebasing"} {
+		path, err := run(gitRoot, "rev-parse", "--git-path", p)
+		if err != nil {
+			continue
+		}
+		if !filepath.IsAbs(path) {
+			path = filepath.Join(gitRoot, path)
+		}
+		if _, err := os.Stat(path); err == nil {
+			return true
+		}
+	}
+	action, err := run(gitRoot, "reflog", "-1", "--format=%gs", "HEAD")
+	return err == nil && strings.HasPrefix(action, "commit (amend)")
+}
+
 func CommitMessage(gitRoot string, hash string) (string, error) {
 	return run(gitRoot, "log", "-1", "--pretty=%B", hash)
 }
@@ -59,17 +143,132 @@ func ChangedFilesSince(gitRoot string, hash string) ([]string, error) {
 	return strings.Split(out, "\n"), nil
 }
 
-func StageFiles(gitRoot string, paths []string) error {
-	args := append([]string{"add"}, paths...)
-	_, err := run(gitRoot, args...)
+// DiffLines counts added plus deleted lines in files between from and to.
+// An empty from counts the changes made by commit to itself. Binary files
+// count as zero.
+func DiffLines(gitRoot string, from string, to string, files []string) (int, error) {
+	args := []string{"diff", "--numstat", from, to, "--"}
+	if from == "" {
+		args = []string{"diff-tree", "--numstat", "-r", "--root", "--no-commit-id", to, "--"}
+	}
+	out, err := run(gitRoot, append(args, files...)...)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 3 {
+			continue
+		}
+		added, err1 := strconv.Atoi(fields[0])
+		deleted, err2 := strconv.Atoi(fields[1])
+		if err1 == nil && err2 == nil {
+			total += added + deleted
+		}
+	}
+	return total, nil
+}
+
+// AddWorktree checks out commit into a new detached worktree at dir.
+func AddWorktree(gitRoot string, dir string, commit string) error {
+	_, err := runInWorktree(gitRoot, "worktree", "add", "--detach", "--quiet", dir, commit)
 	return err
 }
 
-func Commit(gitRoot string, message string) error {
-	_, err := run(gitRoot, "commit", "-m", message)
+// RemoveWorktree deletes the worktree at dir, including local changes.
+func RemoveWorktree(gitRoot string, dir string) error {
+	_, err := run(gitRoot, "worktree", "remove", "--force", dir)
 	return err
 }
 
+// PruneWorktrees drops bookkeeping for worktrees whose directory is gone.
+func PruneWorktrees(gitRoot string) error {
+	_, err := run(gitRoot, "worktree", "prune")
+	return err
+}
+
+// WorkTreeFiles lists the tracked files and the untracked files that
+// aren't ignored in the working tree at dir, without adding anything to
+// the object database.
+func WorkTreeFiles(dir string) ([]string, error) {
+	out, err := runInWorktree(dir, "ls-files", "-z", "--cached", "--others", "--exclude-standard")
+	if err != nil {
+		return nil, err
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(strings.TrimRight(out, "\x00"), "\x00"), nil
+}
+
+func TrackedFiles(gitRoot string) ([]string, error) {
+	out, err := run(gitRoot, "ls-files")
+	if err != nil {
+		return nil, err
+	}
+	if out == "" {
+		return nil, nil
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// ResolveRef returns the commit ref points to, or "" if it doesn't exist.
+func ResolveRef(gitRoot string, ref string) string {
+	hash, err := run(gitRoot, "rev-parse", "--verify", "-q", ref+"^{commit}")
+	if err != nil {
+		return ""
+	}
+	return hash
+}
+
+// FindCommitByTrailer returns the newest commit reachable from ref whose
+// message has the trailer "key: value", or "" if there is none.
+func FindCommitByTrailer(gitRoot string, ref string, key string, value string) (string, error) {
+	out, err := run(gitRoot, "log", "--format=%H", "--fixed-strings", "-1",
+		"--grep", key+": "+value, ref)
+	if err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// Exclude adds pattern to the repository's info/exclude file, unless it
+// is listed there already. Unlike .gitignore, the file is never committed.
+func Exclude(gitRoot string, pattern string) error {
+	path, err := run(gitRoot, "rev-parse", "--git-path", "info/exclude")
+	if err != nil {
+		return err
+	}
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(gitRoot, path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		if strings.TrimSpace(line) == pattern {
+			return nil
+		}
+	}
+	if len(data) > 0 && !strings.HasSuffix(string(data), "\n") {
+		data = append(data, '\n')
+	}
+	data = append(data, pattern+"\n"...)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
+
+// IsIgnored reports whether path is ignored by .gitignore and not tracked.
+func IsIgnored(gitRoot string, path string) bool {
+	cmd := exec.Command("git", "check-ignore", "-q", path)
+	cmd.Dir = gitRoot
+	return cmd.Run() == nil
+}
+
 func HasChanges(gitRoot string, path string) (bool, error) {
 	out, err := run(gitRoot, "status", "--porcelain", path)
 	if err != nil {
@@ -77,3 +276,204 @@ func HasChanges(gitRoot string, path string) (bool, error) {
 	}
 	return out != "", nil
 }
+
+// ErrPushRejected is returned by Push when the remote refuses a
+// non-fast-forward update.
+var ErrPushRejected = errors.New("push rejected: remote has commits not present locally")
+
+// Push pushes refspec to remote. Rejections are read from the porcelain
+// status lines, in the C locale so they aren't translated.
+func Push(gitRoot string, remote string, refspec string) error {
+	cmd := exec.Command("git", "push", "--porcelain", remote, refspec)
+	cmd.Dir = gitRoot
+	cmd.Env = append(os.Environ(), "LC_ALL=C")
+	var stdout, stderr strings.Builder
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		err = fmt.Errorf("git push %s %s: %s", remote, refspec, strings.TrimSpace(stderr.String()))
+		// "!\t<src>:<dst>\t[rejected] (fetch first)"
+		for _, line := range strings.Split(stdout.String(), "\n") {
+			f := strings.Split(line, "\t")
+			if len(f) == 3 && f[0] == "!" && (strings.HasSuffix(f[2], "(fetch first)") || strings.HasSuffix(f[2], "(non-fast-forward)")) {
+				return fmt.Errorf("%w: %v", ErrPushRejected, err)
+			}
+		}
+		return err
+	}
+	return nil
+}
+
+// FetchRef fetches ref from remote and returns the commit it points to.
+func FetchRef(gitRoot string, remote string, ref string) (string, error) {
+	if _, err := run(gitRoot, "fetch", "--quiet", remote, ref); err != nil {
+		return "", err
+	}
+	return run(gitRoot, "rev-parse", "FETCH_HEAD")
+}
+
+// CurrentBranch returns the full ref of the checked-out branch, or "" if
+// HEAD is detached.
+func CurrentBranch(gitRoot string) string {
+	ref, err := run(gitRoot, "symbolic-ref", "-q", "HEAD")
+	if err != nil {
+		return ""
+	}
+	return ref
+}
+
+// CommitsBetween lists the commits reachable from to but not from, oldest
+// first.
+func CommitsBetween(gitRoot string, from string, to string) ([]string, error) {
+	out, err := run(gitRoot, "rev-list", "--reverse", "--topo-order", to, "^"+from)
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// SwitchTree moves the user's index and working tree from commit from to
+// commit to, as a fast-forward would. It fails without changing anything if
+// local changes would be overwritten.
+func SwitchTree(gitRoot string, from string, to string) error {
+	_, err := run(gitRoot, "read-tree", "-m", "-u", from, to)
+	return err
+}
+
+// UpdateRef moves ref to commit if it still points to old.
+func UpdateRef(gitRoot string, ref string, commit string, old string, reason string) error {
+	_, err := run(gitRoot, "update-ref", "-m", reason, ref, commit, old)
+	return err
+}
+
+// LogEntry is a commit as listed by UnpushedCommits.
+type LogEntry struct {
+	Hash    string
+	Parents []string
+	Subject string
+}
+
+// UnpushedCommits lists the commits on ref's first-parent chain that no
+// remote-tracking branch contains, newest first.
+func UnpushedCommits(gitRoot string, ref string) ([]LogEntry, error) {
+	return logEntries(gitRoot, ref, "--not", "--remotes")
+}
+
+// GrepCommits lists the commits on ref's first-parent chain whose message
+// contains text, newest first.
+func GrepCommits(gitRoot string, ref string, text string) ([]LogEntry, error) {
+	return logEntries(gitRoot, "--fixed-strings", "--grep", text, ref)
+}
+
+func logEntries(gitRoot string, args ...string) ([]LogEntry, error) {
+	out, err := run(gitRoot, append([]string{"log", "--first-parent", "--format=%H%x00%P%x00%s"}, args...)...)
+	if err != nil || out == "" {
+		return nil, err
+	}
+	var entries []LogEntry
+	for _, line := range strings.Split(out, "\n") {
+		f := strings.SplitN(line, "\x00", 3)
+		if len(f) != 3 {
+			continue
+		}
+		entries = append(entries, LogEntry{Hash: f[0], Parents: strings.Fields(f[1]), Subject: f[2]})
+	}
+	return entries, nil
+}
+
+// ReversePatch undoes the changes commit made under dir in the working
+// tree, without touching the index. It fails, changing nothing, if the
+// files have changed too much since.
+func ReversePatch(gitRoot string, commit string, dir string) error {
+	patch, err := run(gitRoot, "diff-tree", "-p", "--binary", "--root", "--no-commit-id", commit, "--", dir)
+	if err != nil || patch == "" {
+		return err
+	}
+	f, err := os.CreateTemp("", "repowiki-revert-*.patch")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	_, err = f.WriteString(patch + "\n")
+	f.Close()
+	if err != nil {
+		return err
+	}
+	_, err = run(gitRoot, "apply", "-R", f.Name())
+	return err
+}
+
+// MergeBase returns the best common ancestor of commits a and b.
+func MergeBase(gitRoot string, a, b string) (string, error) {
+	return run(gitRoot, "merge-base", a, b)
+}
+
+// Parents returns the parents of commit.
+func Parents(gitRoot string, commit string) ([]string, error) {
+	out, err := run(gitRoot, "rev-list", "--parents", "-n", "1", commit)
+	if err != nil {
+		return nil, err
+	}
+	return strings.Fields(out)[1:], nil
+}
+
+// Trailers returns the trailers of commit's message, keyed by name, in
+// order.
+func Trailers(gitRoot string, commit string) (map[string][]string, error) {
+	out, err := run(gitRoot, "log", "-1", "--format=%(trailers:only,unfold)", commit)
+	if err != nil {
+		return nil, err
+	}
+	trailers := map[string][]string{}
+	for _, line := range strings.Split(out, "\n") {
+		if key, value, ok := strings.Cut(line, ": "); ok {
+			trailers[key] = append(trailers[key], strings.TrimSpace(value))
+		}
+	}
+	return trailers, nil
+}
+
+// ListCommits lists the commits in a revision range such as "v1.0..v2.0"
+// along the first-parent chain, oldest first.
+func ListCommits(gitRoot string, spec string) ([]string, error) {
+	out, err := run(gitRoot, "rev-list", "--reverse", "--first-parent", spec, "--")
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// TaggedCommits returns the set of commits that tags point to.
+func TaggedCommits(gitRoot string) (map[string]bool, error) {
+	out, err := run(gitRoot, "for-each-ref", "--format=%(objectname) %(*objectname)", "refs/tags")
+	if err != nil {
+		return nil, err
+	}
+	tagged := map[string]bool{}
+	for _, hash := range strings.Fields(out) {
+		tagged[hash] = true
+	}
+	return tagged, nil
+}
+
+// Describe names commit after the nearest tag, or abbreviates it.
+func Describe(gitRoot string, commit string) string {
+	name, err := run(gitRoot, "describe", "--tags", "--always", commit)
+	if err != nil {
+		return commit
+	}
+	return name
+}
+
+// CheckoutDetached switches the worktree at dir to commit, discarding
+// changes to tracked files.
+func CheckoutDetached(dir string, commit string) error {
+	_, err := runInWorktree(dir, "checkout", "--quiet", "--force", "--detach", commit)
+	return err
+}
+
+// DeleteRef deletes ref.
+func DeleteRef(gitRoot string, ref string) error {
+	_, err := run(gitRoot, "update-ref", "-d", ref)
+	return err
+}
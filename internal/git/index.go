@@ -0,0 +1,460 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+// Index is a temporary index file. Building trees through it leaves the
+// user's staging area untouched.
+type Index struct {
+	dir  string
+	path string
+}
+
+// NewIndex creates a temporary index for the repository at dir. With seed,
+// it starts as a copy of the repository's index (reusing its stat cache);
+// otherwise it starts empty.
+func NewIndex(dir string, seed bool) (*Index, error) {
+	f, err := os.CreateTemp("", "repowiki-index-")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temporary index: %w", err)
+	}
+	f.Close()
+	ix := &Index{dir: dir, path: f.Name()}
+
+	// git refuses an empty index file; let it create one instead.
+	os.Remove(ix.path)
+	if seed {
+		real, err := run(dir, "rev-parse", "--git-path", "index")
+		if err != nil {
+			return nil, err
+		}
+		if !filepath.IsAbs(real) {
+			real = filepath.Join(dir, real)
+		}
+		if data, err := os.ReadFile(real); err == nil {
+			if err := os.WriteFile(ix.path, data, 0644); err != nil {
+				return nil, fmt.Errorf("failed to copy index: %w", err)
+			}
+		}
+	}
+	return ix, nil
+}
+
+// Run runs a git command against the temporary index.
+func (ix *Index) Run(args ...string) (string, error) {
+	return runEnv(ix.dir, []string{"GIT_INDEX_FILE=" + ix.path}, args...)
+}
+
+// Remove deletes the temporary index file.
+func (ix *Index) Remove() {
+	os.Remove(ix.path)
+}
+
+// TreeChange is one path that differs between two trees. Status is a
+// git status letter: A (added), M (modified), D (deleted) or T (type
+// changed).
+type TreeChange struct {
+	Status string
+	Path   string
+}
+
+// DiffTrees lists the paths that differ between trees a and b.
+func DiffTrees(dir string, a string, b string) ([]TreeChange, error) {
+	out, err := run(dir, "diff-tree", "-r", "-z", "--no-renames", "--name-status", a, b)
+	if err != nil {
+		return nil, err
+	}
+	var changes []TreeChange
+	fields := strings.Split(strings.TrimRight(out, "\x00"), "\x00")
+	for i := 0; i+1 < len(fields); i += 2 {
+		changes = append(changes, TreeChange{Status: fields[i], Path: fields[i+1]})
+	}
+	return changes, nil
+}
+
+// CommitRequest describes a commit built from a temporary index.
+type CommitRequest struct {
+	// Ref is the ref to advance: "HEAD" for the current branch, or a full
+	// ref name such as "refs/heads/repowiki/wiki", which is created as an
+	// orphan if missing and never checked out.
+	Ref   string
+	Paths []string // paths whose working tree state is committed
+	Force bool     // add paths even if they are ignored
+
+	// Author is "Name <email>" for both author and committer; empty uses
+	// git's user config.
+	Author string
+	// Sign is "off" (never sign), "gpg" or "ssh"; empty follows git's
+	// commit.gpgSign. SigningKey overrides user.signingKey.
+	Sign       string
+	SigningKey string
+
+	// Message builds the commit message from the paths that changed
+	// relative to the parent commit.
+	Message func(changes []TreeChange) string
+}
+
+// CommitPaths commits the working tree state of req.Paths on top of req.Ref
+// using a temporary index, so whatever the user has staged stays staged and
+// out of the commit. It returns the new commit, or "" if the paths have no
+// changes. If the ref moves while the commit is built, it is rebuilt on the
+// new tip.
+func CommitPaths(gitRoot string, req *CommitRequest) (string, error) {
+	var commit string
+	for attempt := 1; ; attempt++ {
+		parent, _ := run(gitRoot, "rev-parse", "--verify", "-q", req.Ref) // "" if the ref doesn't exist yet
+		var message string
+		var err error
+		commit, message, err = commitOnto(gitRoot, parent, req)
+		if err != nil || commit == "" {
+			return "", err
+		}
+		subject, _, _ := strings.Cut(message, "\n")
+		_, err = run(gitRoot, "update-ref", "-m", "commit: "+subject, req.Ref, commit, parent)
+		if err == nil {
+			break
+		}
+		if attempt == 3 {
+			return "", err
+		}
+	}
+	if req.Ref != "HEAD" {
+		return commit, nil
+	}
+
+	// The commit now matches the working tree for the paths; sync the
+	// user's index so they don't show up as staged changes.
+	_, err := run(gitRoot, append([]string{"reset", "-q", "HEAD", "--"}, req.Paths...)...)
+	return commit, err
+}
+
+// BuildCommit creates the commit CommitPaths would, on top of req.Ref, but
+// doesn't move any ref. It returns "" if the paths have no changes.
+func BuildCommit(gitRoot string, req *CommitRequest) (string, error) {
+	parent, _ := run(gitRoot, "rev-parse", "--verify", "-q", req.Ref)
+	commit, _, err := commitOnto(gitRoot, parent, req)
+	return commit, err
+}
+
+// FormatPatch writes commit as a mailbox patch, as git format-patch does.
+// With dir set, the patch goes to a file in dir named after the subject and
+// its path is returned; otherwise it is written to file.
+func FormatPatch(gitRoot string, commit string, file string, dir string) (string, error) {
+	args := []string{"format-patch", "-1", "--root"}
+	if dir != "" {
+		out, err := run(gitRoot, append(args, "-o", dir, commit)...)
+		return out, err
+	}
+	out, err := run(gitRoot, append(args, "--stdout", commit)...)
+	if err != nil {
+		return "", err
+	}
+	return file, os.WriteFile(file, []byte(out+"\n"), 0644)
+}
+
+// FormatPatchSeries writes every commit reachable from ref, from the root
+// on, as numbered mailbox patches in dir and returns their paths.
+func FormatPatchSeries(gitRoot string, ref string, dir string) ([]string, error) {
+	out, err := run(gitRoot, "format-patch", "--root", "-o", dir, ref)
+	if err != nil || out == "" {
+		return nil, err
+	}
+	return strings.Split(out, "\n"), nil
+}
+
+// commitOnto creates (but doesn't check out) a commit with parent's tree
+// plus the working tree state of req.Paths, and returns it with its
+// message. It returns "" if nothing changed.
+func commitOnto(gitRoot string, parent string, req *CommitRequest) (string, string, error) {
+	ix, err := NewIndex(gitRoot, false)
+	if err != nil {
+		return "", "", err
+	}
+	defer ix.Remove()
+
+	if parent != "" {
+		if _, err := ix.Run("read-tree", parent); err != nil {
+			return "", "", err
+		}
+	}
+	add := []string{"add", "-A"}
+	if req.Force {
+		add = append(add, "-f")
+	}
+	if _, err := ix.Run(append(append(add, "--"), req.Paths...)...); err != nil {
+		return "", "", err
+	}
+	tree, err := ix.Run("write-tree")
+	if err != nil {
+		return "", "", err
+	}
+	return newCommit(gitRoot, tree, parent, req)
+}
+
+// newCommit creates a commit of tree on top of parent ("" for an orphan)
+// with req's message, identity and signing, and returns it with its
+// message. It returns "" if tree is the parent's tree.
+func newCommit(gitRoot string, tree string, parent string, req *CommitRequest) (string, string, error) {
+	// An orphan commit is diffed against the empty tree.
+	parentTree, err := run(gitRoot, "mktree")
+	if parent != "" {
+		parentTree, err = run(gitRoot, "rev-parse", parent+"^{tree}")
+	}
+	if err != nil {
+		return "", "", err
+	}
+	if tree == parentTree {
+		return "", "", nil
+	}
+	changes, err := DiffTrees(gitRoot, parentTree, tree)
+	if err != nil {
+		return "", "", err
+	}
+
+	message := req.Message(changes)
+	pre, sign, err := signArgs(gitRoot, req.Sign, req.SigningKey)
+	if err != nil {
+		return "", "", err
+	}
+	args := append(pre, "commit-tree", tree, "-m", message)
+	args = append(args, sign...)
+	if parent != "" {
+		args = append(args, "-p", parent)
+	}
+	env, err := identityEnv(req.Author)
+	if err != nil {
+		return "", "", err
+	}
+	commit, err := runEnv(gitRoot, env, args...)
+	return commit, message, err
+}
+
+// SquashCommits replaces the commits on req.Ref after base (exclusive; ""
+// for the root) up to tip with one commit of tip's tree, and returns it.
+// The message is built from the changes between base and tip. The ref is
+// only moved if it still points to tip; the working tree is unaffected.
+func SquashCommits(gitRoot string, base string, tip string, req *CommitRequest) (string, error) {
+	tree, err := run(gitRoot, "rev-parse", tip+"^{tree}")
+	if err != nil {
+		return "", err
+	}
+	commit, message, err := newCommit(gitRoot, tree, base, req)
+	if err != nil {
+		return "", err
+	}
+	if commit == "" {
+		// The commits cancel out.
+		if base == "" {
+			return "", fmt.Errorf("commits up to %s have no changes", tip)
+		}
+		commit, message = base, "no changes"
+	}
+	subject, _, _ := strings.Cut(message, "\n")
+	if _, err := run(gitRoot, "update-ref", "-m", "squash: "+subject, req.Ref, commit, tip); err != nil {
+		return "", err
+	}
+	return commit, nil
+}
+
+// signArgs returns the git options selecting the signature format and the
+// commit-tree flags that request a signature. commit-tree ignores
+// commit.gpgSign, so the default mode checks it here.
+func signArgs(gitRoot string, mode string, key string) (pre []string, sign []string, err error) {
+	switch mode {
+	case "off":
+		return nil, nil, nil
+	case "":
+		if on, _ := run(gitRoot, "config", "--bool", "commit.gpgSign"); on != "true" {
+			return nil, nil, nil
+		}
+	case "gpg":
+		pre = []string{"-c", "gpg.format=openpgp"}
+	case "ssh":
+		pre = []string{"-c", "gpg.format=ssh"}
+	default:
+		return nil, nil, fmt.Errorf("unknown signing mode %q", mode)
+	}
+	return pre, []string{"-S" + key}, nil
+}
+
+// identityEnv sets author and committer to author ("Name <email>").
+func identityEnv(author string) ([]string, error) {
+	if author == "" {
+		return nil, nil
+	}
+	name, email, ok := strings.Cut(author, "<")
+	name = strings.TrimSpace(name)
+	email = strings.TrimSuffix(strings.TrimSpace(email), ">")
+	if !ok || name == "" || email == "" {
+		return nil, fmt.Errorf("invalid commit author %q, want \"Name <email>\"", author)
+	}
+	return []string{
+		"GIT_AUTHOR_NAME=" + name, "GIT_AUTHOR_EMAIL=" + email,
+		"GIT_COMMITTER_NAME=" + name, "GIT_COMMITTER_EMAIL=" + email,
+	}, nil
+}
+
+// CheckoutDir writes the files under dir in commit's tree into the working
+// tree at gitRoot, without touching the user's index or HEAD. Files outside
+// dir are left alone.
+func CheckoutDir(gitRoot string, commit string, dir string) error {
+	ix, err := NewIndex(gitRoot, false)
+	if err != nil {
+		return err
+	}
+	defer ix.Remove()
+	dir = strings.Trim(filepath.ToSlash(dir), "/")
+	if _, err := ix.Run("read-tree", "--prefix="+dir+"/", commit+":"+dir); err != nil {
+		return err
+	}
+	_, err = ix.Run("checkout-index", "-a", "-f")
+	return err
+}
+
+// ErrRebaseConflict is returned by RebaseCommits when a commit changes a
+// path that also changed on the branch it is rebased onto.
+var ErrRebaseConflict = errors.New("rebase conflict")
+
+// RebaseCommits recreates commits (oldest first) on top of onto and returns
+// the new tip. Each commit keeps its message and author and replays only
+// the paths it changed, taking its own version of them; all other files
+// come from onto. A commit changing a path that also changed between its
+// base (the parent of the first commit) and onto fails with
+// ErrRebaseConflict. Commits for which own reports true get req's
+// committer and signature; the rest are committed as git's user config
+// says. Hashes of earlier commits in a message are replaced by those of
+// their copies. Merge commits are refused.
+func RebaseCommits(gitRoot string, commits []string, onto string, req *CommitRequest, own func(message string) bool) (string, error) {
+	pre, sign, err := signArgs(gitRoot, req.Sign, req.SigningKey)
+	if err != nil {
+		return "", err
+	}
+	committer, err := identityEnv(req.Author)
+	if err != nil {
+		return "", err
+	}
+	userPre, userSign, err := signArgs(gitRoot, "", "")
+	if err != nil {
+		return "", err
+	}
+
+	tip := onto
+	rewritten := map[string]string{}
+	var theirs map[string]bool
+	for _, c := range commits {
+		parents, err := Parents(gitRoot, c)
+		if err != nil {
+			return "", err
+		}
+		if len(parents) != 1 {
+			return "", fmt.Errorf("cannot rebase %s: it has %d parents", c, len(parents))
+		}
+		if theirs == nil {
+			changes, err := DiffTrees(gitRoot, parents[0], onto)
+			if err != nil {
+				return "", err
+			}
+			theirs = map[string]bool{}
+			for _, ch := range changes {
+				theirs[ch.Path] = true
+			}
+		}
+		tree, err := replayTree(gitRoot, c, tip, theirs)
+		if err != nil {
+			return "", err
+		}
+
+		meta, err := run(gitRoot, "log", "-1", "--format=%an%x00%ae%x00%ad%x00%B", "--date=raw", c)
+		if err != nil {
+			return "", err
+		}
+		f := strings.SplitN(meta, "\x00", 4)
+		if len(f) != 4 {
+			return "", fmt.Errorf("cannot read commit %s", c)
+		}
+		msg := f[3]
+		for old, hash := range rewritten {
+			msg = strings.ReplaceAll(msg, old, hash)
+		}
+		env, args, signing := []string(nil), userPre, userSign
+		if own(f[3]) {
+			env, args, signing = committer, pre, sign
+		}
+		// Later entries win, so the original author overrides req.Author.
+		env = append(env, "GIT_AUTHOR_NAME="+f[0], "GIT_AUTHOR_EMAIL="+f[1], "GIT_AUTHOR_DATE="+f[2])
+		args = append(slices.Clip(args), "commit-tree", tree, "-p", tip, "-m", msg)
+		tip, err = runEnv(gitRoot, env, append(args, signing...)...)
+		if err != nil {
+			return "", err
+		}
+		rewritten[c] = tip
+	}
+	return tip, nil
+}
+
+// replayTree returns base's tree with the paths commit changed relative to
+// its parent set to their state in commit. It fails with ErrRebaseConflict
+// if any of those paths is in theirs.
+func replayTree(gitRoot string, commit string, base string, theirs map[string]bool) (string, error) {
+	changes, err := DiffTrees(gitRoot, commit+"^", commit)
+	if err != nil {
+		return "", err
+	}
+	var conflicts []string
+	for _, c := range changes {
+		if theirs[c.Path] {
+			conflicts = append(conflicts, c.Path)
+		}
+	}
+	if len(conflicts) > 0 {
+		return "", fmt.Errorf("%w: %s and the remote both changed %s", ErrRebaseConflict, commit, strings.Join(conflicts, ", "))
+	}
+	ix, err := NewIndex(gitRoot, false)
+	if err != nil {
+		return "", err
+	}
+	defer ix.Remove()
+	if _, err := ix.Run("read-tree", base); err != nil {
+		return "", err
+	}
+
+	var removed, kept []string
+	for _, c := range changes {
+		if c.Status == "D" {
+			removed = append(removed, c.Path)
+		} else {
+			kept = append(kept, c.Path)
+		}
+	}
+	if len(removed) > 0 {
+		if _, err := ix.Run(append([]string{"update-index", "--force-remove", "--"}, removed...)...); err != nil {
+			return "", err
+		}
+	}
+	if len(kept) > 0 {
+		out, err := run(gitRoot, append([]string{"--literal-pathspecs", "ls-tree", "-z", "--full-tree", commit, "--"}, kept...)...)
+		if err != nil {
+			return "", err
+		}
+		args := []string{"update-index", "--add"}
+		for _, entry := range strings.Split(strings.TrimRight(out, "\x00"), "\x00") {
+			// "<mode> <type> <hash>\t<path>"
+			info, path, _ := strings.Cut(entry, "\t")
+			f := strings.Fields(info)
+			if len(f) != 3 {
+				continue
+			}
+			args = append(args, "--cacheinfo", f[0]+","+f[2]+","+path)
+		}
+		if _, err := ix.Run(args...); err != nil {
+			return "", err
+		}
+	}
+	return ix.Run("write-tree")
+}
@@ -0,0 +1,163 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/engine"
+)
+
+const historyFile = "runs.jsonl"
+
+// Run kinds.
+const (
+	KindFull        = "full"
+	KindIncremental = "incremental"
+)
+
+// Run statuses.
+const (
+	StatusOK       = "ok"
+	StatusFailed   = "failed"
+	StatusTimedOut = "timed_out"
+	StatusCanceled = "canceled"
+)
+
+// Run is one engine invocation as recorded in .repowiki/runs.jsonl.
+type Run struct {
+	ID         string `json:"id"`
+	Kind       string `json:"kind"`
+	Commit     string `json:"commit,omitempty"`
+	Engine     string `json:"engine"`
+	Model      string `json:"model,omitempty"`
+	Started    string `json:"started"`
+	DurationMS int64  `json:"duration_ms"`
+	Status     string `json:"status"`
+	Error      string `json:"error,omitempty"`
+
+	// Violations lists files outside the wiki the engine modified.
+	Violations []string `json:"violations,omitempty"`
+
+	Usage *engine.Usage `json:"usage,omitempty"`
+}
+
+// Totals aggregates usage over a set of runs.
+type Totals struct {
+	Period       string // "2006-01-02" or "2006-01", empty for overall totals
+	Runs         int
+	Failed       int
+	InputTokens  int
+	OutputTokens int
+	CachedTokens int
+	CostUSD      float64
+}
+
+func (t *Totals) add(r *Run) {
+	t.Runs++
+	if r.Status != StatusOK {
+		t.Failed++
+	}
+	if r.Usage != nil {
+		t.InputTokens += r.Usage.InputTokens
+		t.OutputTokens += r.Usage.OutputTokens
+		t.CachedTokens += r.Usage.CacheReadTokens + r.Usage.CacheCreationTokens
+		t.CostUSD += r.Usage.CostUSD
+	}
+}
+
+// Total aggregates all given runs.
+func Total(runs []Run) Totals {
+	var t Totals
+	for i := range runs {
+		t.add(&runs[i])
+	}
+	return t
+}
+
+// Since returns the runs started at or after t.
+func Since(runs []Run, t time.Time) []Run {
+	var out []Run
+	for _, r := range runs {
+		started, err := time.Parse(time.RFC3339, r.Started)
+		if err == nil && !started.Before(t) {
+			out = append(out, r)
+		}
+	}
+	return out
+}
+
+// ByPeriod groups runs by the local start time formatted with layout (e.g.
+// "2006-01-02" for days, "2006-01" for months), oldest period first.
+func ByPeriod(runs []Run, layout string) []Totals {
+	idx := map[string]int{}
+	var out []Totals
+	for i := range runs {
+		started, err := time.Parse(time.RFC3339, runs[i].Started)
+		if err != nil {
+			continue
+		}
+		key := started.Local().Format(layout)
+		n, ok := idx[key]
+		if !ok {
+			n = len(out)
+			idx[key] = n
+			out = append(out, Totals{Period: key})
+		}
+		out[n].add(&runs[i])
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Period < out[j].Period })
+	return out
+}
+
+func path(gitRoot string) string {
+	return filepath.Join(config.Dir(gitRoot), historyFile)
+}
+
+// Append adds a run to the history file.
+func Append(gitRoot string, run *Run) error {
+	if err := os.MkdirAll(config.Dir(gitRoot), 0755); err != nil {
+		return fmt.Errorf("failed to create config dir: %w", err)
+	}
+	data, err := json.Marshal(run)
+	if err != nil {
+		return fmt.Errorf("failed to marshal run: %w", err)
+	}
+	f, err := os.OpenFile(path(gitRoot), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open run history: %w", err)
+	}
+	defer f.Close()
+	_, err = f.Write(append(data, '\n'))
+	return err
+}
+
+// Load returns all recorded runs, oldest first. A missing history file is
+// not an error. Malformed lines are skipped.
+func Load(gitRoot string) ([]Run, error) {
+	f, err := os.Open(path(gitRoot))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("failed to open run history: %w", err)
+	}
+	defer f.Close()
+
+	var runs []Run
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 1024*1024)
+	for sc.Scan() {
+		var r Run
+		if err := json.Unmarshal(sc.Bytes(), &r); err != nil {
+			continue
+		}
+		runs = append(runs, r)
+	}
+	return runs, sc.Err()
+}
@@ -12,25 +12,62 @@ const (
 	markerEnd   = "# repowiki hook end"
 )
 
-func hookPath(gitRoot string) string {
-	return filepath.Join(gitRoot, ".git", "hooks", "post-commit")
+// Hooks repowiki installs. post-rewrite runs after `commit --amend` and
+// rebase with git's old→new commit mapping on stdin.
+const (
+	PostCommit  = "post-commit"
+	PostRewrite = "post-rewrite"
+)
+
+var hooks = []string{PostCommit, PostRewrite}
+
+func hookPath(gitRoot string, name string) string {
+	return filepath.Join(gitRoot, ".git", "hooks", name)
 }
 
-// Script generates the hook script using the absolute path to the repowiki binary.
-func Script(binaryPath string) string {
+// script generates the block for hook name using the absolute path to the
+// repowiki binary. post-commit returns right away
+// and leaves the work to a background process; post-rewrite only rewrites
+// config and must read its stdin before git moves on, so it runs in the
+// foreground.
+func script(name string, binaryPath string) string {
+	call, bg := `hooks post-commit`, " &"
+	if name == PostRewrite {
+		call, bg = `hooks post-rewrite "$1"`, ""
+	}
 	return markerStart + `
 # Auto-generated by repowiki — do not edit this block
 REPOWIKI_BIN="` + binaryPath + `"
 if [ -x "$REPOWIKI_BIN" ]; then
-  "$REPOWIKI_BIN" hooks post-commit &
+  "$REPOWIKI_BIN" ` + call + bg + `
 elif command -v repowiki >/dev/null 2>&1; then
-  repowiki hooks post-commit &
+  repowiki ` + call + bg + `
 fi
 ` + markerEnd
 }
 
+// Install adds the repowiki block to the post-commit and post-rewrite
+// hooks. Hooks that already have it are left alone unless force is set, so
+// running it again after an upgrade installs only the missing ones.
 func Install(gitRoot string, force bool, binaryPath string) error {
-	hp := hookPath(gitRoot)
+	installed := 0
+	for _, name := range hooks {
+		if IsHookInstalled(gitRoot, name) && !force {
+			installed++
+			continue
+		}
+		if err := install(gitRoot, name, binaryPath); err != nil {
+			return err
+		}
+	}
+	if installed == len(hooks) {
+		return fmt.Errorf("repowiki hook already installed; use --force to reinstall")
+	}
+	return nil
+}
+
+func install(gitRoot string, name string, binaryPath string) error {
+	hp := hookPath(gitRoot, name)
 
 	// Ensure hooks directory exists
 	if err := os.MkdirAll(filepath.Dir(hp), 0755); err != nil {
@@ -40,24 +77,27 @@ func Install(gitRoot string, force bool, binaryPath string) error {
 	// Read existing hook file if present
 	data, err := os.ReadFile(hp)
 	if err == nil {
-		content := string(data)
-		if strings.Contains(content, markerStart) {
-			if !force {
-				return fmt.Errorf("repowiki hook already installed; use --force to reinstall")
-			}
-			content = removeBlock(content)
-		}
-		content = strings.TrimRight(content, "\n") + "\n\n" + Script(binaryPath) + "\n"
+		content := removeBlock(string(data))
+		content = strings.TrimRight(content, "\n") + "\n\n" + script(name, binaryPath) + "\n"
 		return os.WriteFile(hp, []byte(content), 0755)
 	}
 
 	// Create new hook file
-	content := "#!/bin/sh\n\n" + Script(binaryPath) + "\n"
+	content := "#!/bin/sh\n\n" + script(name, binaryPath) + "\n"
 	return os.WriteFile(hp, []byte(content), 0755)
 }
 
 func Uninstall(gitRoot string) error {
-	hp := hookPath(gitRoot)
+	for _, name := range hooks {
+		if err := uninstall(gitRoot, name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func uninstall(gitRoot string, name string) error {
+	hp := hookPath(gitRoot, name)
 	data, err := os.ReadFile(hp)
 	if err != nil {
 		return nil // No hook file
@@ -74,8 +114,25 @@ func Uninstall(gitRoot string) error {
 	return os.WriteFile(hp, []byte(content), 0755)
 }
 
+// IsInstalled reports whether the post-commit hook is installed.
 func IsInstalled(gitRoot string) bool {
-	data, err := os.ReadFile(hookPath(gitRoot))
+	return IsHookInstalled(gitRoot, PostCommit)
+}
+
+// Missing returns the hooks without the repowiki block.
+func Missing(gitRoot string) []string {
+	var missing []string
+	for _, name := range hooks {
+		if !IsHookInstalled(gitRoot, name) {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// IsHookInstalled reports whether hook name has the repowiki block.
+func IsHookInstalled(gitRoot string, name string) bool {
+	data, err := os.ReadFile(hookPath(gitRoot, name))
 	if err != nil {
 		return false
 	}
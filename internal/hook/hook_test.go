@@ -0,0 +1,91 @@
+package hook
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func git(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_GLOBAL="+os.DevNull, "GIT_CONFIG_NOSYSTEM=1",
+		"GIT_AUTHOR_NAME=Dev", "GIT_AUTHOR_EMAIL=dev@example.com",
+		"GIT_COMMITTER_NAME=Dev", "GIT_COMMITTER_EMAIL=dev@example.com")
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func TestPostRewriteHookPassesMapping(t *testing.T) {
+	root := t.TempDir()
+	git(t, root, "init", "-q")
+	git(t, root, "commit", "-q", "--allow-empty", "-m", "first")
+	old := git(t, root, "rev-parse", "HEAD")
+
+	// A stand-in binary that records post-rewrite calls and their stdin.
+	record := filepath.Join(t.TempDir(), "calls")
+	bin := filepath.Join(t.TempDir(), "repowiki")
+	stub := "#!/bin/sh\nif [ \"$2\" = post-rewrite ]; then echo \"$@\" >> " + record + "; cat >> " + record + "; fi\n"
+	if err := os.WriteFile(bin, []byte(stub), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := Install(root, false, bin); err != nil {
+		t.Fatalf("Install: %v", err)
+	}
+
+	git(t, root, "commit", "-q", "--amend", "--allow-empty", "-m", "reworded")
+	data, err := os.ReadFile(record)
+	if err != nil {
+		t.Fatalf("post-rewrite hook did not run: %v", err)
+	}
+	want := "hooks post-rewrite amend\n" + old + " " + git(t, root, "rev-parse", "HEAD") + "\n"
+	if string(data) != want {
+		t.Errorf("post-rewrite call = %q, want %q", data, want)
+	}
+}
+
+func TestInstallAddsMissingHooks(t *testing.T) {
+	root := t.TempDir()
+	git(t, root, "init", "-q")
+	custom := "#!/bin/sh\necho custom\n"
+	if err := os.WriteFile(hookPath(root, PostRewrite), []byte(custom), 0755); err != nil {
+		t.Fatal(err)
+	}
+	// As installed by a version that only knew post-commit.
+	if err := install(root, PostCommit, "/bin/repowiki"); err != nil {
+		t.Fatal(err)
+	}
+	if got := Missing(root); len(got) != 1 || got[0] != PostRewrite {
+		t.Errorf("Missing = %v, want [%s]", got, PostRewrite)
+	}
+
+	if err := Install(root, false, "/bin/repowiki"); err != nil {
+		t.Fatalf("Install with a missing hook: %v", err)
+	}
+	if got := Missing(root); len(got) != 0 {
+		t.Errorf("Missing after Install = %v", got)
+	}
+	data, err := os.ReadFile(hookPath(root, PostRewrite))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(data), custom) || !strings.Contains(string(data), `hooks post-rewrite "$1"`) {
+		t.Errorf("post-rewrite hook =\n%s\nwant the existing script followed by the repowiki block", data)
+	}
+	if err := Install(root, false, "/bin/repowiki"); err == nil {
+		t.Errorf("Install with every hook present succeeded without force")
+	}
+
+	if err := Uninstall(root); err != nil {
+		t.Fatalf("Uninstall: %v", err)
+	}
+	if data, _ := os.ReadFile(hookPath(root, PostRewrite)); strings.TrimSpace(string(data)) != strings.TrimSpace(custom) {
+		t.Errorf("Uninstall left post-rewrite =\n%s\nwant the existing script", data)
+	}
+}
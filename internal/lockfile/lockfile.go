@@ -6,6 +6,7 @@ import (
 	"path/filepath"
 	"strconv"
 	"strings"
+	"syscall"
 	"time"
 )
 
@@ -53,6 +54,73 @@ func IsLocked(gitRoot string) bool {
 	return err == nil
 }
 
+// Holder describes the process holding the lock.
+type Holder struct {
+	PID       int
+	Acquired  time.Time // when the lock was taken or last refreshed
+	EnginePID int       // process group of the running engine, 0 if none
+}
+
+// ReadHolder parses the lock file. It fails if there is no lock.
+func ReadHolder(gitRoot string) (*Holder, error) {
+	data, err := os.ReadFile(lockPath(gitRoot))
+	if err != nil {
+		return nil, err
+	}
+	lines := strings.Split(string(data), "\n")
+	pid, err := strconv.Atoi(strings.TrimSpace(lines[0]))
+	if err != nil {
+		return nil, fmt.Errorf("malformed lock file: %w", err)
+	}
+	h := &Holder{PID: pid}
+	if len(lines) >= 2 {
+		h.Acquired, _ = time.Parse(time.RFC3339, strings.TrimSpace(lines[1]))
+	}
+	if len(lines) >= 3 {
+		h.EnginePID, _ = strconv.Atoi(strings.TrimSpace(lines[2]))
+	}
+	return h, nil
+}
+
+// SetEnginePID records the engine subprocess in the lock held by this
+// process, so `repowiki cancel` can stop it even if the holder hangs.
+func SetEnginePID(gitRoot string, pid int) error {
+	h, err := ReadHolder(gitRoot)
+	if err != nil {
+		return err
+	}
+	if h.PID != os.Getpid() {
+		return fmt.Errorf("lock is held by another process (%d)", h.PID)
+	}
+	content := fmt.Sprintf("%d\n%s\n%d\n", h.PID, h.Acquired.UTC().Format(time.RFC3339), pid)
+	return os.WriteFile(lockPath(gitRoot), []byte(content), 0644)
+}
+
+// Refresh resets the age of the lock held by this process, so that long
+// runs made of several engine attempts aren't taken for stale.
+func Refresh(gitRoot string) error {
+	h, err := ReadHolder(gitRoot)
+	if err != nil {
+		return err
+	}
+	if h.PID != os.Getpid() {
+		return fmt.Errorf("lock is held by another process (%d)", h.PID)
+	}
+	content := fmt.Sprintf("%d\n%s\n%d\n", h.PID, time.Now().UTC().Format(time.RFC3339), h.EnginePID)
+	return os.WriteFile(lockPath(gitRoot), []byte(content), 0644)
+}
+
+// IsAlive reports whether a process with the given PID exists.
+func IsAlive(pid int) bool {
+	if pid <= 0 {
+		return false
+	}
+	// Signal 0 performs error checking only. EPERM means the process
+	// exists but belongs to someone else.
+	err := syscall.Kill(pid, syscall.Signal(0))
+	return err == nil || err == syscall.EPERM
+}
+
 func isStale(lp string) bool {
 	data, err := os.ReadFile(lp)
 	if err != nil {
@@ -70,17 +138,10 @@ func isStale(lp string) bool {
 	}
 
 	// Check if process is still running
-	proc, err := os.FindProcess(pid)
-	if err != nil {
+	if !IsAlive(pid) {
 		return true
 	}
 
-	// On Unix, FindProcess always succeeds. Send signal 0 to check.
-	err = proc.Signal(os.Signal(nil))
-	if err != nil {
-		return true // Process not running
-	}
-
 	// Check age - stale if older than 30 minutes
 	if len(lines) >= 2 {
 		ts, err := time.Parse(time.RFC3339, strings.TrimSpace(lines[1]))
@@ -0,0 +1,350 @@
+package wiki
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/engine"
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/history"
+	"github.com/GoooIce/repowiki/internal/lockfile"
+)
+
+const (
+	backfillFile = "backfill.json"
+
+	// backfillPatchRef holds the wiki commits of a backfill written as
+	// patches until they are formatted.
+	backfillPatchRef = "refs/repowiki/backfill"
+)
+
+// BackfillOptions selects the commits a backfill documents and where the
+// wiki commits go.
+type BackfillOptions struct {
+	Range     string // revision range, e.g. "v1.0..v2.0"
+	Every     int    // document every Nth commit (and the last); 0 or 1 for all
+	Tags      bool   // document only tagged commits
+	Branch    string // branch for the wiki commits (default: the wiki branch)
+	OutputDir string // write the wiki commits as patches here instead
+}
+
+// backfillState is the progress of a backfill, saved after every step in
+// .repowiki/backfill.json so an interrupted backfill can resume.
+type backfillState struct {
+	Range     string   `json:"range"`
+	Ref       string   `json:"ref"`
+	OutputDir string   `json:"output_dir,omitempty"`
+	Commits   []string `json:"commits"`
+	Done      int      `json:"done"`          // commits processed so far
+	Tip       string   `json:"tip,omitempty"` // Ref after the last step
+}
+
+// BackfillResult summarizes a finished backfill.
+type BackfillResult struct {
+	Ref     string   // branch written, "" for patches
+	Commits int      // wiki commits made
+	Patches []string // patch files written
+}
+
+func backfillPath(gitRoot string) string {
+	return filepath.Join(config.Dir(gitRoot), backfillFile)
+}
+
+func loadBackfill(gitRoot string) (*backfillState, error) {
+	data, err := os.ReadFile(backfillPath(gitRoot))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var st backfillState
+	if err := json.Unmarshal(data, &st); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", backfillFile, err)
+	}
+	return &st, nil
+}
+
+func (st *backfillState) save(gitRoot string) error {
+	data, err := json.MarshalIndent(st, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(backfillPath(gitRoot), append(data, '\n'), 0644)
+}
+
+// BackfillInProgress returns the range of an interrupted backfill, or "".
+func BackfillInProgress(gitRoot string) string {
+	st, err := loadBackfill(gitRoot)
+	if err != nil || st == nil {
+		return ""
+	}
+	return st.Range
+}
+
+// AbortBackfill forgets an interrupted backfill. Wiki commits it already
+// wrote to a branch are kept.
+func AbortBackfill(gitRoot string) error {
+	st, err := loadBackfill(gitRoot)
+	if err != nil || st == nil {
+		return err
+	}
+	if st.OutputDir != "" {
+		git.DeleteRef(gitRoot, st.Ref)
+	}
+	return os.Remove(backfillPath(gitRoot))
+}
+
+// Backfill documents the history in opts.Range one commit at a time. Each
+// selected commit is checked out in a scratch worktree together with the
+// wiki as of the previous step, the engine updates the wiki there (a full
+// generation for the first), and the result becomes a wiki commit with a
+// Repowiki-Source trailer. The user's checkout is never touched. Running
+// it again for the same range after an interruption resumes where it
+// stopped. progress is called before each step.
+func Backfill(ctx context.Context, gitRoot string, cfg *config.Config, opts BackfillOptions, progress func(step int, total int, commit string)) (*BackfillResult, error) {
+	if err := lock(gitRoot); err != nil {
+		return nil, fmt.Errorf("cannot acquire lock: %w", err)
+	}
+	defer unlock(gitRoot)
+
+	st, err := loadBackfill(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	if st == nil {
+		if st, err = startBackfill(gitRoot, cfg, opts); err != nil {
+			return nil, err
+		}
+	} else if opts.Range != "" && opts.Range != st.Range {
+		return nil, fmt.Errorf("a backfill of %s is in progress; finish it or run 'repowiki backfill --abort'", st.Range)
+	}
+	if err := reconcileBackfill(gitRoot, st); err != nil {
+		return nil, err
+	}
+
+	if st.Done < len(st.Commits) {
+		if err := runBackfill(ctx, gitRoot, cfg, st, progress); err != nil {
+			return nil, err
+		}
+	}
+
+	res := &BackfillResult{Ref: st.Ref}
+	if st.Tip != "" {
+		n, err := git.ListCommits(gitRoot, st.Tip)
+		if err != nil {
+			return nil, err
+		}
+		res.Commits = len(n)
+	}
+	if st.OutputDir != "" {
+		res.Ref = ""
+		if st.Tip != "" {
+			if err := os.MkdirAll(st.OutputDir, 0755); err != nil {
+				return nil, err
+			}
+			if res.Patches, err = git.FormatPatchSeries(gitRoot, st.Ref, st.OutputDir); err != nil {
+				return nil, err
+			}
+			git.DeleteRef(gitRoot, st.Ref)
+		}
+	}
+	logf(gitRoot, "backfill of %s complete: %d wiki commits", st.Range, res.Commits)
+	return res, os.Remove(backfillPath(gitRoot))
+}
+
+// startBackfill picks the commits to document and records the new backfill.
+func startBackfill(gitRoot string, cfg *config.Config, opts BackfillOptions) (*backfillState, error) {
+	if opts.Range == "" {
+		return nil, fmt.Errorf("no commit range given")
+	}
+	commits, err := git.ListCommits(gitRoot, opts.Range)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Tags {
+		tagged, err := git.TaggedCommits(gitRoot)
+		if err != nil {
+			return nil, err
+		}
+		var picked []string
+		for _, c := range commits {
+			if tagged[c] {
+				picked = append(picked, c)
+			}
+		}
+		commits = picked
+	} else if opts.Every > 1 {
+		var picked []string
+		for i, c := range commits {
+			if (i+1)%opts.Every == 0 || i == len(commits)-1 {
+				picked = append(picked, c)
+			}
+		}
+		commits = picked
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no commits to document in %s", opts.Range)
+	}
+
+	st := &backfillState{Range: opts.Range, Commits: commits}
+	switch {
+	case opts.OutputDir != "":
+		st.Ref = backfillPatchRef
+		st.OutputDir = opts.OutputDir
+		git.DeleteRef(gitRoot, st.Ref)
+	case opts.Branch != "":
+		st.Ref = "refs/heads/" + opts.Branch
+	default:
+		st.Ref = cfg.WikiBranchRef()
+	}
+	if git.ResolveRef(gitRoot, st.Ref) != "" || (st.Ref == cfg.WikiBranchRef() && WikiBranchTip(gitRoot, cfg) != "") {
+		return nil, fmt.Errorf("%s already exists; backfill into a new branch with --branch", strings.TrimPrefix(st.Ref, "refs/heads/"))
+	}
+	return st, st.save(gitRoot)
+}
+
+// reconcileBackfill checks that st.Ref is where the backfill left it. A
+// wiki commit for the next step on top of st.Tip is adopted: the backfill
+// stopped after making it but before saving its progress.
+func reconcileBackfill(gitRoot string, st *backfillState) error {
+	tip := git.ResolveRef(gitRoot, st.Ref)
+	if tip == st.Tip {
+		return nil
+	}
+	if tip != "" && st.Done < len(st.Commits) {
+		parents, err := git.Parents(gitRoot, tip)
+		if err != nil {
+			return err
+		}
+		t, err := git.Trailers(gitRoot, tip)
+		if err != nil {
+			return err
+		}
+		onTip := (st.Tip == "" && len(parents) == 0) || (len(parents) == 1 && parents[0] == st.Tip)
+		if onTip && slices.Equal(t[SourceTrailer], st.Commits[st.Done:st.Done+1]) {
+			logf(gitRoot, "backfill: adopting %s, made for step %d before the backfill stopped", tip, st.Done+1)
+			st.Done++
+			st.Tip = tip
+			return st.save(gitRoot)
+		}
+	}
+	if st.OutputDir != "" {
+		return fmt.Errorf("%s moved since the backfill stopped; run 'repowiki backfill --abort' and start over", st.Ref)
+	}
+	name := strings.TrimPrefix(st.Ref, "refs/heads/")
+	return fmt.Errorf("%s moved since the backfill stopped; run 'repowiki backfill --abort', delete the branch with 'git branch -D %s', and start over", name, name)
+}
+
+// runBackfill processes the remaining commits of st in a scratch worktree.
+func runBackfill(ctx context.Context, gitRoot string, cfg *config.Config, st *backfillState, progress func(int, int, string)) error {
+	dir, err := os.MkdirTemp("", "repowiki-backfill-")
+	if err != nil {
+		return err
+	}
+	if err := git.AddWorktree(gitRoot, dir, st.Commits[st.Done]); err != nil {
+		os.RemoveAll(dir)
+		return fmt.Errorf("creating scratch worktree: %w", err)
+	}
+	sb := &sandbox{gitRoot: gitRoot, dir: dir}
+	defer sb.remove()
+	logf(gitRoot, "backfilling %s from step %d of %d in %s", st.Range, st.Done+1, len(st.Commits), sb.dir)
+
+	ctx = engine.WithStartHook(ctx, func(pid int) {
+		lockfile.SetEnginePID(gitRoot, pid)
+	})
+	for st.Done < len(st.Commits) {
+		// Each step can take a while; keep the lock from looking stale.
+		if err := lockfile.Refresh(gitRoot); err != nil {
+			return fmt.Errorf("lost the lock: %w", err)
+		}
+		commit := st.Commits[st.Done]
+		if progress != nil {
+			progress(st.Done+1, len(st.Commits), commit)
+		}
+		prev := ""
+		if st.Done > 0 {
+			prev = st.Commits[st.Done-1]
+		}
+		if err := backfillStep(ctx, gitRoot, sb.dir, cfg, st, commit, prev); err != nil {
+			return err
+		}
+		st.Done++
+		st.Tip = git.ResolveRef(gitRoot, st.Ref)
+		if err := st.save(gitRoot); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// backfillStep checks out commit in dir with the wiki as of the last step,
+// runs the engine, and commits the wiki to st.Ref.
+func backfillStep(ctx context.Context, gitRoot string, dir string, cfg *config.Config, st *backfillState, commit string, prev string) (err error) {
+	if err := git.CheckoutDetached(dir, commit); err != nil {
+		return err
+	}
+	if err := os.RemoveAll(filepath.Join(dir, cfg.WikiPath)); err != nil {
+		return err
+	}
+	if st.Tip != "" {
+		if err := git.CheckoutDir(dir, st.Tip, cfg.WikiPath); err != nil {
+			return fmt.Errorf("restoring wiki from %s: %w", st.Tip, err)
+		}
+	}
+
+	kind := history.KindFull
+	ch := config.Change{Kind: kind}
+	prompt := BuildFullGeneratePrompt(cfg)
+	if Exists(dir, cfg) && prev != "" {
+		files, err := git.ChangedFilesSince(dir, prev)
+		if err != nil {
+			return err
+		}
+		files = FilterExcluded(files, cfg.ExcludedPaths)
+		if len(files) == 0 {
+			logf(gitRoot, "backfill: no relevant changes in %s", commit)
+			return nil
+		}
+		sections := AffectedSections(dir, cfg, files)
+		lines, _ := git.DiffLines(dir, prev, commit, files)
+		kind = history.KindIncremental
+		ch = config.Change{Kind: kind, Files: len(files), Lines: lines, Sections: len(sections)}
+		prompt = BuildIncrementalPrompt(cfg, files, sections)
+	}
+
+	run := startRun(cfg, kind, commit)
+	defer func() { run.finish(gitRoot, err) }()
+	routed := routeModel(gitRoot, cfg, ch)
+
+	g, err := startGuard(gitRoot, dir, cfg.WikiPath)
+	if err != nil {
+		return err
+	}
+	result, err := runChain(ctx, gitRoot, dir, routed, prompt)
+	run.setResult(result)
+	if err = joinViolation(err, g.check()); err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("engine run %w", ctx.Err())
+		}
+		logEngineError(gitRoot, err)
+		return fmt.Errorf("backfill of %s failed: %w", commit, err)
+	}
+	logEngineResult(gitRoot, result)
+
+	info := commitInfo(commit, "backfill wiki at "+git.Describe(gitRoot, commit), result)
+	req := commitRequest(gitRoot, cfg, info)
+	req.Ref = st.Ref
+	req.Paths = []string{filepath.Join(dir, cfg.WikiPath)}
+	req.Force = true
+	if _, err := git.CommitPaths(dir, req); err != nil {
+		return fmt.Errorf("failed to commit backfilled wiki: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package wiki
+
+import (
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// backfillRepo returns a test repo with three source commits after the
+// initial one, oldest first.
+func backfillRepo(t *testing.T) (*testRepo, []string) {
+	t.Helper()
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	var commits []string
+	for _, f := range []string{"a.go", "b.go", "c.go"} {
+		r.write(f, "package main\n")
+		commits = append(commits, r.commit("add "+f))
+	}
+	return r, commits
+}
+
+func (r *testRepo) backfill(opts BackfillOptions) (*BackfillResult, error) {
+	r.t.Helper()
+	return Backfill(context.Background(), r.root, r.reload(), opts, nil)
+}
+
+func TestBackfill(t *testing.T) {
+	r, commits := backfillRepo(t)
+	res, err := r.backfill(BackfillOptions{Range: "HEAD~3..HEAD"})
+	if err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+	if res.Commits != 3 {
+		t.Errorf("Backfill made %d wiki commits, want 3", res.Commits)
+	}
+	var sources []string
+	for _, c := range strings.Split(r.git("rev-list", "--reverse", res.Ref), "\n") {
+		trailers, err := git.Trailers(r.root, c)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sources = append(sources, trailers[SourceTrailer]...)
+	}
+	if !slices.Equal(sources, commits) {
+		t.Errorf("wiki commits document %v, want %v", sources, commits)
+	}
+	if BackfillInProgress(r.root) != "" {
+		t.Errorf("finished backfill still in progress")
+	}
+}
+
+func TestBackfillAdoptsUnsavedStep(t *testing.T) {
+	r, commits := backfillRepo(t)
+	res, err := r.backfill(BackfillOptions{Range: "HEAD~3..HEAD"})
+	if err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+	tip := r.git("rev-parse", res.Ref)
+
+	// Stopped after committing the last step but before saving progress.
+	st := &backfillState{Range: "HEAD~3..HEAD", Ref: res.Ref, Commits: commits, Done: 2, Tip: r.git("rev-parse", res.Ref+"~1")}
+	if err := st.save(r.root); err != nil {
+		t.Fatal(err)
+	}
+	res, err = r.backfill(BackfillOptions{})
+	if err != nil {
+		t.Fatalf("resuming Backfill: %v", err)
+	}
+	if got := r.git("rev-parse", res.Ref); got != tip || res.Commits != 3 {
+		t.Errorf("resumed backfill ended at %s with %d commits, want %s with 3", got, res.Commits, tip)
+	}
+}
+
+func TestBackfillRefusesMovedBranch(t *testing.T) {
+	r, commits := backfillRepo(t)
+	res, err := r.backfill(BackfillOptions{Range: "HEAD~3..HEAD"})
+	if err != nil {
+		t.Fatalf("Backfill: %v", err)
+	}
+
+	// The branch was moved back, so its tip documents an earlier step.
+	st := &backfillState{Range: "HEAD~3..HEAD", Ref: res.Ref, Commits: commits, Done: 2, Tip: r.git("rev-parse", res.Ref+"~1")}
+	if err := st.save(r.root); err != nil {
+		t.Fatal(err)
+	}
+	r.git("update-ref", res.Ref, res.Ref+"~2")
+	_, err = r.backfill(BackfillOptions{})
+	if err == nil || !strings.Contains(err.Error(), "git branch -D") {
+		t.Fatalf("Backfill error = %v, want a refusal suggesting to delete the branch", err)
+	}
+}
@@ -0,0 +1,76 @@
+package wiki
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// WikiBranchTip returns the commit the wiki branch points to. A branch
+// fetched from origin but not yet created locally is used as well. It
+// returns "" if neither exists.
+func WikiBranchTip(gitRoot string, cfg *config.Config) string {
+	ref := cfg.WikiBranchRef()
+	if tip := git.ResolveRef(gitRoot, ref); tip != "" {
+		return tip
+	}
+	return git.ResolveRef(gitRoot, remoteWikiRef(cfg))
+}
+
+// remoteWikiRef is origin's copy of the wiki branch.
+func remoteWikiRef(cfg *config.Config) string {
+	return "refs/remotes/origin/" + strings.TrimPrefix(cfg.WikiBranchRef(), "refs/heads/")
+}
+
+// trackWikiBranch creates the local wiki branch from origin's copy in a
+// fresh clone, so the next wiki commit extends the fetched history instead
+// of starting a new one.
+func trackWikiBranch(gitRoot string, cfg *config.Config) error {
+	if !cfg.UsesWikiBranch() || git.ResolveRef(gitRoot, cfg.WikiBranchRef()) != "" {
+		return nil
+	}
+	tip := git.ResolveRef(gitRoot, remoteWikiRef(cfg))
+	if tip == "" {
+		return nil
+	}
+	if err := git.UpdateRef(gitRoot, cfg.WikiBranchRef(), tip, "", "repowiki: track "+strings.TrimPrefix(remoteWikiRef(cfg), "refs/remotes/")); err != nil {
+		return fmt.Errorf("creating wiki branch from origin: %w", err)
+	}
+	logf(gitRoot, "created %s from %s", cfg.WikiBranchRef(), remoteWikiRef(cfg))
+	return nil
+}
+
+// CheckoutWiki replaces the local wiki directory with its contents on the
+// wiki branch, without checking the branch out. With sourceHash, it picks
+// the wiki commit that documents that source commit. It returns the wiki
+// commit used.
+func CheckoutWiki(gitRoot string, cfg *config.Config, sourceHash string) (string, error) {
+	tip := WikiBranchTip(gitRoot, cfg)
+	if tip == "" {
+		return "", fmt.Errorf("wiki branch %s does not exist", strings.TrimPrefix(cfg.WikiBranchRef(), "refs/heads/"))
+	}
+
+	commit := tip
+	if sourceHash != "" {
+		var err error
+		commit, err = git.FindCommitByTrailer(gitRoot, tip, SourceTrailer, sourceHash)
+		if err != nil {
+			return "", err
+		}
+		if commit == "" {
+			return "", fmt.Errorf("no wiki commit documents %s", sourceHash)
+		}
+	}
+
+	if err := os.RemoveAll(filepath.Join(gitRoot, cfg.WikiPath)); err != nil {
+		return "", fmt.Errorf("failed to clear wiki directory: %w", err)
+	}
+	if err := git.CheckoutDir(gitRoot, commit, cfg.WikiPath); err != nil {
+		return "", fmt.Errorf("failed to check out wiki: %w", err)
+	}
+	return commit, nil
+}
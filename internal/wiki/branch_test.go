@@ -0,0 +1,47 @@
+package wiki
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+func TestFreshCloneExtendsFetchedWikiBranch(t *testing.T) {
+	branchStorage := func(cfg *config.Config) { cfg.Storage = config.StorageBranch }
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, branchStorage)
+	r.generate()
+	wikiRef := r.cfg.WikiBranchRef()
+	upstreamTip := r.git("rev-parse", wikiRef)
+
+	remote := filepath.Join(t.TempDir(), "origin.git")
+	runGit(t, r.root, "init", "-q", "--bare", remote)
+	r.git("push", "-q", remote, "main", wikiRef)
+
+	c := &testRepo{t: t, root: filepath.Join(t.TempDir(), "clone")}
+	runGit(t, r.root, "clone", "-q", "-b", "main", remote, c.root)
+	if got := c.git("for-each-ref", "--format=%(refname)", "refs/heads/repowiki"); got != "" {
+		t.Fatalf("clone already has a local wiki branch: %s", got)
+	}
+	c.cfg = config.Default()
+	c.cfg.Enabled = true
+	c.cfg.Engine = config.EngineFake
+	branchStorage(c.cfg)
+	c.cfg.LastCommitHash = c.head()
+	c.saveConfig()
+	if _, err := CheckoutWiki(c.root, c.cfg, ""); err != nil {
+		t.Fatalf("CheckoutWiki: %v", err)
+	}
+
+	c.write("util.go", "package main\n")
+	c.commit("add util")
+	if err := c.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+	if parent := c.git("rev-parse", wikiRef+"~1"); parent != upstreamTip {
+		t.Errorf("new wiki commit's parent = %s, want origin's wiki tip %s", parent, upstreamTip)
+	}
+	if !c.exists(c.page("util.go")) {
+		t.Errorf("page for util.go missing")
+	}
+}
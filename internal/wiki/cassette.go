@@ -0,0 +1,176 @@
+package wiki
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/engine"
+)
+
+// Cassette is a recorded engine invocation: what was sent to the engine,
+// what it printed, and how it changed the wiki directory.
+type Cassette struct {
+	RecordedAt string            `json:"recorded_at"`
+	Engine     string            `json:"engine"`
+	Model      string            `json:"model,omitempty"`
+	Prompt     string            `json:"prompt"`
+	Argv       []string          `json:"argv,omitempty"`
+	Env        map[string]string `json:"env,omitempty"`
+	Stdout     string            `json:"stdout"`
+	Stderr     string            `json:"stderr,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	Usage      *engine.Usage     `json:"usage,omitempty"`
+	Files      []FileChange      `json:"files"`
+}
+
+// Environment variables captured in cassettes, by prefix or exact name.
+var (
+	cassetteEnvPrefixes = []string{"REPOWIKI_", "ANTHROPIC_", "CLAUDE_", "OPENAI_", "CODEX_", "QODER_"}
+	cassetteEnvNames    = []string{"PATH", "HOME", "LANG"}
+	secretMarkers       = []string{"KEY", "TOKEN", "SECRET", "PASSWORD"}
+)
+
+func cassetteEnv() map[string]string {
+	env := map[string]string{}
+	for _, kv := range os.Environ() {
+		k, v, _ := strings.Cut(kv, "=")
+		keep := false
+		for _, n := range cassetteEnvNames {
+			keep = keep || k == n
+		}
+		for _, p := range cassetteEnvPrefixes {
+			keep = keep || strings.HasPrefix(k, p)
+		}
+		if !keep {
+			continue
+		}
+		for _, m := range secretMarkers {
+			if strings.Contains(k, m) {
+				v = "<redacted>"
+				break
+			}
+		}
+		env[k] = v
+	}
+	return env
+}
+
+// recordEngine runs the engine in workDir and writes a cassette of the
+// invocation to dir, whether or not the engine succeeded.
+func recordEngine(ctx context.Context, gitRoot string, workDir string, cfg *config.Config, prompt string, dir string) (*engine.Result, error) {
+	before := takeSnapshot(workDir, cfg.WikiPath)
+	result, runErr := runChain(ctx, gitRoot, workDir, cfg, prompt)
+	after := takeSnapshot(workDir, cfg.WikiPath)
+
+	c := Cassette{
+		RecordedAt: time.Now().UTC().Format(time.RFC3339),
+		Engine:     cfg.Engine,
+		Model:      cfg.Model,
+		Prompt:     prompt,
+		Env:        cassetteEnv(),
+		Files:      before.diff(after),
+	}
+	if result != nil {
+		c.Engine = result.Engine
+		c.Model = result.Model
+		c.Argv = result.Argv
+		c.Stdout = result.Output
+		c.Stderr = result.Stderr
+		c.Usage = result.Usage
+	}
+	if runErr != nil {
+		c.Error = runErr.Error()
+	}
+
+	path, err := saveCassette(dir, &c)
+	if err != nil {
+		logf(gitRoot, "failed to record cassette: %v", err)
+	} else {
+		logf(gitRoot, "recorded cassette %s (%d file changes)", path, len(c.Files))
+	}
+	return result, runErr
+}
+
+func saveCassette(dir string, c *Cassette) (string, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create cassette dir: %w", err)
+	}
+	existing, err := cassettePaths(dir)
+	if err != nil {
+		return "", err
+	}
+	// Prompts and pages are full of <cite> tags; keep them readable.
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(c); err != nil {
+		return "", fmt.Errorf("failed to marshal cassette: %w", err)
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%03d.json", len(existing)+1))
+	return path, os.WriteFile(path, buf.Bytes(), 0644)
+}
+
+// cassettePaths lists the cassettes in dir in recording order.
+func cassettePaths(dir string) ([]string, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette dir: %w", err)
+	}
+	var paths []string
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".json") {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+	sort.Strings(paths)
+	return paths, nil
+}
+
+// replayEngine applies the next unplayed cassette from opts.Replay instead of
+// running the engine.
+func replayEngine(gitRoot string, cfg *config.Config, prompt string, opts *Options) (*engine.Result, error) {
+	paths, err := cassettePaths(opts.Replay)
+	if err != nil {
+		return nil, err
+	}
+	if opts.replayed >= len(paths) {
+		return nil, fmt.Errorf("no cassette left to replay in %s (%d played)", opts.Replay, opts.replayed)
+	}
+	path := paths[opts.replayed]
+	opts.replayed++
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read cassette: %w", err)
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+
+	logf(gitRoot, "replaying cassette %s (%d file changes)", path, len(c.Files))
+	if c.Prompt != prompt {
+		logf(gitRoot, "warning: replayed prompt differs from the recorded one")
+	}
+	if err := checkChanges(c.Files, cfg.WikiPath); err != nil {
+		return nil, fmt.Errorf("invalid cassette %s: %w", path, err)
+	}
+	if err := applyChanges(gitRoot, c.Files); err != nil {
+		return nil, fmt.Errorf("failed to apply cassette %s: %w", path, err)
+	}
+
+	result := &engine.Result{Engine: c.Engine, Model: c.Model, Output: c.Stdout, Stderr: c.Stderr, Argv: c.Argv, Usage: c.Usage}
+	if c.Error != "" {
+		return result, fmt.Errorf("replayed engine error: %s", c.Error)
+	}
+	return result, nil
+}
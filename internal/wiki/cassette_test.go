@@ -0,0 +1,67 @@
+package wiki
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+func TestCassetteRoundTripsBinaryContent(t *testing.T) {
+	root := t.TempDir()
+	cfg := config.Default()
+	png := []byte{0x89, 'P', 'N', 'G', 0x0d, 0x0a, 0x1a, 0x0a, 0x00, 0xff, 0xfe, 0x80}
+	page := []byte("# Overview\n\n<cite>main.go</cite>\n")
+
+	dir := t.TempDir()
+	c := &Cassette{Engine: "fake", Prompt: "p", Files: []FileChange{
+		{Path: cfg.WikiPath + "/en/assets/diagram.png", Content: png},
+		{Path: cfg.WikiPath + "/en/content/Overview.md", Content: page},
+	}}
+	if _, err := saveCassette(dir, c); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := replayEngine(root, cfg, "p", &Options{Replay: dir}); err != nil {
+		t.Fatalf("replayEngine: %v", err)
+	}
+	for _, f := range c.Files {
+		got, err := os.ReadFile(filepath.Join(root, filepath.FromSlash(f.Path)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, f.Content) {
+			t.Errorf("%s = %q, want %q", f.Path, got, f.Content)
+		}
+	}
+}
+
+func TestCassetteRejectsPathsOutsideWiki(t *testing.T) {
+	cfg := config.Default()
+	for _, path := range []string{
+		"main.go",
+		cfg.WikiPath + "/../../main.go",
+		"/etc/passwd",
+		cfg.WikiPath + "-other/page.md",
+	} {
+		root := t.TempDir()
+		dir := t.TempDir()
+		c := &Cassette{Engine: "fake", Files: []FileChange{
+			{Path: cfg.WikiPath + "/en/content/ok.md", Content: []byte("ok")},
+			{Path: path, Content: []byte("pwned")},
+		}}
+		if _, err := saveCassette(dir, c); err != nil {
+			t.Fatal(err)
+		}
+		_, err := replayEngine(root, cfg, "", &Options{Replay: dir})
+		if err == nil || !strings.Contains(err.Error(), "outside the wiki directory") {
+			t.Errorf("replaying a change to %s: err = %v, want it rejected", path, err)
+		}
+		if _, err := os.Stat(filepath.Join(root, cfg.WikiPath)); !os.IsNotExist(err) {
+			t.Errorf("replaying a change to %s wrote files before rejecting it", path)
+		}
+	}
+}
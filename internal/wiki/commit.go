@@ -3,8 +3,11 @@ package wiki
 import (
 	"fmt"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
 	"strconv"
+	"strings"
 
 	"github.com/GoooIce/repowiki/internal/config"
 	"github.com/GoooIce/repowiki/internal/git"
@@ -22,39 +25,193 @@ func IsSentinelPresent(gitRoot string) bool {
 	return err == nil
 }
 
-// CommitChanges stages and commits wiki changes with loop prevention.
-func CommitChanges(gitRoot string, cfg *config.Config, description string) error {
+// Trailers added to wiki commits.
+const (
+	SourceTrailer = "Repowiki-Source" // source commit the wiki documents
+	EngineTrailer = "Repowiki-Engine"
+	ModelTrailer  = "Repowiki-Model"
+	PagesTrailer  = "Repowiki-Pages"   // comma-separated pages changed
+	RevertTrailer = "Repowiki-Reverts" // wiki commit undone by a revert
+)
+
+// CommitInfo describes the run a wiki commit comes from.
+type CommitInfo struct {
+	Source      string // source commit documented
+	Description string // subject after the commit prefix
+	Engine      string // engine that produced the result, after fallback
+	Model       string
+	Reverts     []string // wiki commits this commit reverts
+}
+
+// CommitChanges commits wiki changes with loop prevention. The commit is
+// built from a temporary index, so it contains only the wiki and repowiki
+// config, and anything the user has staged in the meantime stays staged.
+// In branch storage mode the wiki goes to the wiki branch instead. It
+// returns the new commit, or "" if there was nothing to commit.
+func CommitChanges(gitRoot string, cfg *config.Config, info *CommitInfo) (string, error) {
 	wikiDir := filepath.Join(gitRoot, cfg.WikiPath)
 
-	// Check if there are any changes to commit
-	hasChanges, err := git.HasChanges(gitRoot, wikiDir)
-	if err != nil || !hasChanges {
-		return nil // Nothing to commit
+	// Check if there are any changes to commit. In branch mode the wiki is
+	// usually ignored on the working branch; the tree comparison in
+	// git.CommitPaths decides instead.
+	if !cfg.UsesWikiBranch() {
+		hasChanges, err := git.HasChanges(gitRoot, wikiDir)
+		if err != nil || !hasChanges {
+			return "", nil // Nothing to commit
+		}
 	}
 
 	// Write sentinel file (loop prevention layer 1)
 	sp := sentinelPath(gitRoot)
 	if err := os.WriteFile(sp, []byte(strconv.Itoa(os.Getpid())), 0644); err != nil {
-		return fmt.Errorf("failed to write sentinel: %w", err)
+		return "", fmt.Errorf("failed to write sentinel: %w", err)
 	}
 	defer os.Remove(sp)
 
-	// Stage wiki files
-	if err := git.StageFiles(gitRoot, []string{wikiDir}); err != nil {
-		return fmt.Errorf("failed to stage wiki files: %w", err)
+	if err := trackWikiBranch(gitRoot, cfg); err != nil {
+		return "", err
+	}
+	req := commitRequest(gitRoot, cfg, info)
+	if !cfg.UsesWikiBranch() {
+		// Also commit config (updated last_run, last_commit_hash) unless
+		// the project ignores it
+		configPath := config.Path(gitRoot)
+		if _, err := os.Stat(configPath); err == nil && !git.IsIgnored(gitRoot, configPath) {
+			req.Paths = append(req.Paths, configPath)
+		}
 	}
 
-	// Also stage config (updated last_run, last_commit_hash)
-	configPath := config.Path(gitRoot)
-	if _, err := os.Stat(configPath); err == nil {
-		git.StageFiles(gitRoot, []string{configPath})
+	commit, err := git.CommitPaths(gitRoot, req)
+	if err != nil {
+		return "", fmt.Errorf("failed to commit wiki: %w", err)
 	}
+	return commit, nil
+}
 
-	// Commit with recognizable prefix
-	message := fmt.Sprintf("%s %s", cfg.CommitPrefix, description)
-	if err := git.Commit(gitRoot, message); err != nil {
-		return fmt.Errorf("failed to commit wiki: %w", err)
+// commitRequest describes a wiki commit on the branch the storage mode
+// selects, with the configured identity and signing.
+func commitRequest(gitRoot string, cfg *config.Config, info *CommitInfo) *git.CommitRequest {
+	req := &git.CommitRequest{
+		Ref:   "HEAD",
+		Paths: []string{filepath.Join(gitRoot, cfg.WikiPath)},
+		Message: func(changes []git.TreeChange) string {
+			return commitMessage(cfg, info, changes)
+		},
+		Author:     cfg.CommitAuthor,
+		Sign:       cfg.CommitSign,
+		SigningKey: cfg.CommitSigningKey,
+	}
+	if cfg.UsesWikiBranch() {
+		req.Ref = cfg.WikiBranchRef()
+		req.Force = true
 	}
+	return req
+}
 
+// commitMessage builds the wiki commit message: the prefixed subject, the
+// pages updated and deleted, and trailers linking back to the source.
+func commitMessage(cfg *config.Config, info *CommitInfo, changes []git.TreeChange) string {
+	t := trailers{}
+	t.add(SourceTrailer, info.Source)
+	t.add(EngineTrailer, info.Engine)
+	t.add(ModelTrailer, info.Model)
+	for _, c := range info.Reverts {
+		t.add(RevertTrailer, c)
+	}
+	return formatMessage(cfg, info.Description, t, changes)
+}
+
+// trailers collects trailer values by key, without repeats.
+type trailers map[string][]string
+
+func (t trailers) add(key string, value string) {
+	if value != "" && !slices.Contains(t[key], value) {
+		t[key] = append(t[key], value)
+	}
+}
+
+// formatMessage lays out a wiki commit message with the run trailers in t
+// (one line per value) followed by the pages trailer.
+func formatMessage(cfg *config.Config, description string, t trailers, changes []git.TreeChange) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s\n", cfg.CommitPrefix, description)
+
+	updated, deleted := changedPages(cfg, changes)
+	for _, section := range []struct {
+		title string
+		pages []string
+	}{{"Updated pages:", updated}, {"Deleted pages:", deleted}} {
+		if len(section.pages) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n%s\n", section.title)
+		for _, p := range section.pages {
+			fmt.Fprintf(&b, "- %s\n", p)
+		}
+	}
+
+	b.WriteString("\n")
+	for _, key := range []string{SourceTrailer, EngineTrailer, ModelTrailer, RevertTrailer} {
+		for _, v := range t[key] {
+			fmt.Fprintf(&b, "%s: %s\n", key, v)
+		}
+	}
+	if pages := slices.Concat(updated, deleted); len(pages) > 0 {
+		fmt.Fprintf(&b, "%s: %s\n", PagesTrailer, strings.Join(pages, ", "))
+	}
+	return strings.TrimRight(b.String(), "\n")
+}
+
+// changedPages names the wiki pages among changes, relative to the content
+// directory and without the .md extension.
+func changedPages(cfg *config.Config, changes []git.TreeChange) (updated, deleted []string) {
+	contentDir := path.Join(filepath.ToSlash(cfg.WikiPath), cfg.Language, "content") + "/"
+	for _, c := range changes {
+		if !strings.HasPrefix(c.Path, contentDir) || !strings.HasSuffix(c.Path, ".md") {
+			continue
+		}
+		page := strings.TrimSuffix(strings.TrimPrefix(c.Path, contentDir), ".md")
+		if c.Status == "D" {
+			deleted = append(deleted, page)
+		} else {
+			updated = append(updated, page)
+		}
+	}
+	return updated, deleted
+}
+
+// patchRequest describes the commit a patch is made from: a wiki commit on
+// the branch it would go to, or origin's copy of the wiki branch in a
+// fresh clone.
+func patchRequest(gitRoot string, cfg *config.Config, info *CommitInfo) *git.CommitRequest {
+	req := commitRequest(gitRoot, cfg, info)
+	if cfg.UsesWikiBranch() && git.ResolveRef(gitRoot, req.Ref) == "" && WikiBranchTip(gitRoot, cfg) != "" {
+		req.Ref = remoteWikiRef(cfg)
+	}
+	return req
+}
+
+// checkPatchBase refuses to write a patch when the wiki already differs
+// from the branch the patch is made against, since those changes would end
+// up in the patch along with the run's.
+func checkPatchBase(gitRoot string, cfg *config.Config) error {
+	commit, err := git.BuildCommit(gitRoot, patchRequest(gitRoot, cfg, &CommitInfo{}))
+	if err != nil {
+		return err
+	}
+	if commit != "" {
+		return fmt.Errorf("%s has uncommitted changes; commit or discard them before writing a patch", cfg.WikiPath)
+	}
 	return nil
 }
+
+// writePatch turns the wiki changes into a patch against the branch they'd
+// be committed to, without moving it. It returns the file written, or ""
+// if the wiki has no changes.
+func writePatch(gitRoot string, cfg *config.Config, info *CommitInfo, opts *Options) (string, error) {
+	commit, err := git.BuildCommit(gitRoot, patchRequest(gitRoot, cfg, info))
+	if err != nil || commit == "" {
+		return "", err
+	}
+	return git.FormatPatch(gitRoot, commit, opts.Patch, opts.PatchDir)
+}
@@ -0,0 +1,40 @@
+package wiki
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCommitLeavesUserIndexAlone(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	r.write("util.go", "package main\n")
+	source := r.commit("add util")
+
+	// Work the user did after the commit, while the update runs.
+	r.write("staged.go", "package main\n")
+	r.git("add", "staged.go")
+	r.write("main.go", "package main\n\nfunc main() {}\n")
+
+	if err := r.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+
+	if parent := r.git("rev-parse", "HEAD~1"); parent != source {
+		t.Errorf("wiki commit's parent = %s, want the source commit %s", parent, source)
+	}
+	for _, p := range strings.Split(r.git("diff", "--name-only", "HEAD~1", "HEAD"), "\n") {
+		if !underDir(p, r.cfg.WikiPath) && p != ".repowiki/config.json" {
+			t.Errorf("wiki commit contains %s", p)
+		}
+	}
+	if staged := r.git("diff", "--cached", "--name-only"); staged != "staged.go" {
+		t.Errorf("staged files after the update = %q, want staged.go", staged)
+	}
+	if unstaged := r.git("diff", "--name-only"); unstaged != "main.go" {
+		t.Errorf("unstaged files after the update = %q, want main.go", unstaged)
+	}
+	if got := r.read("main.go"); got != "package main\n\nfunc main() {}\n" {
+		t.Errorf("main.go = %q, unstaged edit lost", got)
+	}
+}
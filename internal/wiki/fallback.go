@@ -0,0 +1,95 @@
+package wiki
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/engine"
+	"github.com/GoooIce/repowiki/internal/lockfile"
+)
+
+// runChain runs the primary engine in dir and then each fallback engine
+// until one succeeds. Transient failures are retried per engine with exponential
+// backoff; permanent failures move straight on to the next engine. Wiki
+// files a failed attempt wrote are put back before the next one, and the
+// lock is refreshed around every attempt so a long chain isn't taken for a
+// stale run. The returned result's usage covers every attempt.
+func runChain(ctx context.Context, gitRoot string, dir string, cfg *config.Config, prompt string) (result *engine.Result, err error) {
+	var lastResult *engine.Result
+	var lastErr error
+	var usage *engine.Usage
+	defer func() {
+		if usage == nil {
+			return
+		}
+		if result == nil {
+			result = &engine.Result{}
+		}
+		result.Usage = usage
+	}()
+	chain := cfg.EngineChain()
+	before := takeSnapshot(dir, cfg.WikiPath)
+
+	for i, name := range chain {
+		ecfg := cfg.ForEngine(name)
+		attempts := 1 + max(ecfg.SettingsFor(name).Retries, 0)
+
+		for attempt := 1; attempt <= attempts; attempt++ {
+			if i > 0 && attempt == 1 {
+				logf(gitRoot, "falling back to engine %s", name)
+			}
+			lockfile.Refresh(gitRoot)
+			result, err := engine.Run(ctx, ecfg, dir, prompt)
+			if result != nil && result.Usage != nil {
+				if usage == nil {
+					usage = &engine.Usage{}
+				}
+				usage.Add(result.Usage)
+			}
+			if err == nil {
+				if i > 0 || attempt > 1 {
+					logf(gitRoot, "engine %s succeeded on attempt %d", name, attempt)
+				}
+				return result, nil
+			}
+			lockfile.Refresh(gitRoot)
+			lastResult, lastErr = result, err
+
+			class := engine.Classify(err)
+			logf(gitRoot, "engine %s attempt %d/%d failed (%s): %v", name, attempt, attempts, class, err)
+			if class == engine.Canceled {
+				return result, err
+			}
+			restoreWiki(gitRoot, dir, cfg.WikiPath, before)
+			if class == engine.Permanent || attempt == attempts {
+				break
+			}
+
+			wait := cfg.Backoff(attempt)
+			logf(gitRoot, "retrying engine %s in %s", name, wait)
+			select {
+			case <-time.After(wait):
+			case <-ctx.Done():
+				return result, fmt.Errorf("engine run %w", ctx.Err())
+			}
+		}
+	}
+
+	if len(chain) > 1 {
+		return lastResult, fmt.Errorf("all engines failed (%v): %w", chain, lastErr)
+	}
+	return lastResult, lastErr
+}
+
+// restoreWiki puts the wiki in dir back to before, undoing a failed run's
+// partial writes.
+func restoreWiki(gitRoot string, dir string, wikiPath string, before snapshot) {
+	changes := takeSnapshot(dir, wikiPath).diff(before)
+	if err := applyChanges(dir, changes); err != nil {
+		logf(gitRoot, "failed to revert partial wiki changes: %v", err)
+	} else if len(changes) > 0 {
+		logf(gitRoot, "reverted %d partially written wiki files", len(changes))
+	}
+}
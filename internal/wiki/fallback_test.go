@@ -0,0 +1,108 @@
+package wiki
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/lockfile"
+)
+
+func TestRunChainRevertsFailedAttempts(t *testing.T) {
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Engine = "flaky"
+	cfg.FallbackEngines = []string{config.EngineFake}
+	cfg.RetryBackoff = "1ms"
+	partial := filepath.Join(cfg.WikiPath, "en", "content", "Partial.md")
+	cfg.Engines = map[string]config.EngineSettings{
+		"flaky": {
+			Retries: 1,
+			Command: []string{"sh", "-c", fmt.Sprintf(
+				"mkdir -p $(dirname %s) && echo partial >> %s && echo 'API Error: 503 Service Unavailable' >&2 && exit 1",
+				partial, partial)},
+		},
+	}
+	if err := os.WriteFile(filepath.Join(dir, "a.go"), []byte("package a\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// Hold the lock with an old timestamp; the chain must refresh it.
+	if err := lockfile.Acquire(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer lockfile.Release(dir)
+	old := time.Now().Add(-20 * time.Minute).UTC().Format(time.RFC3339)
+	lock := filepath.Join(dir, config.ConfigDir, ".repowiki.lock")
+	if err := os.WriteFile(lock, []byte(fmt.Sprintf("%d\n%s\n", os.Getpid(), old)), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	prompt := "CHANGED SOURCE FILES:\n  - a.go\n"
+	result, err := runChain(context.Background(), dir, dir, cfg, prompt)
+	if err != nil {
+		t.Fatalf("runChain: %v", err)
+	}
+	if result.Engine != config.EngineFake {
+		t.Errorf("result from %s, want the fallback %s", result.Engine, config.EngineFake)
+	}
+	if _, err := os.Stat(filepath.Join(dir, partial)); !os.IsNotExist(err) {
+		t.Errorf("failed attempts' %s was not reverted", partial)
+	}
+	if _, err := os.Stat(filepath.Join(dir, cfg.WikiPath, "en", "content", "Files", "a.go.md")); err != nil {
+		t.Errorf("fallback engine's page missing: %v", err)
+	}
+	h, err := lockfile.ReadHolder(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if time.Since(h.Acquired) > time.Minute {
+		t.Errorf("lock timestamp %s was not refreshed", h.Acquired)
+	}
+}
+
+func TestRunChainAddsUsageOfEveryAttempt(t *testing.T) {
+	// The first attempt spends a turn and then hits a 503; the retry
+	// finishes in one turn.
+	var calls int
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		switch calls {
+		case 1:
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","tool_calls":[{"id":"1","type":"function","function":{"name":"Glob","arguments":"{\"pattern\":\"*\"}"}}]}}],"usage":{"prompt_tokens":1000,"completion_tokens":50}}`)
+		case 2:
+			http.Error(w, "upstream busy", http.StatusServiceUnavailable)
+		default:
+			fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"done"}}],"usage":{"prompt_tokens":400,"completion_tokens":20}}`)
+		}
+	}))
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := config.Default()
+	cfg.Engine = config.EngineOpenAICompatible
+	cfg.Model = "stub"
+	cfg.RetryBackoff = "1ms"
+	cfg.Engines = map[string]config.EngineSettings{
+		config.EngineOpenAICompatible: {BaseURL: srv.URL, Retries: 1, InputPrice: 1, OutputPrice: 10},
+	}
+
+	result, err := runChain(context.Background(), dir, dir, cfg, "update")
+	if err != nil {
+		t.Fatalf("runChain: %v", err)
+	}
+	u := result.Usage
+	if u == nil || u.InputTokens != 1400 || u.OutputTokens != 70 || u.Turns != 2 {
+		t.Fatalf("usage = %+v, want 1400 input and 70 output tokens over 2 turns", u)
+	}
+	if want := (1400*1.0 + 70*10.0) / 1_000_000; math.Abs(u.CostUSD-want) > 1e-12 {
+		t.Errorf("cost = %f, want %f", u.CostUSD, want)
+	}
+}
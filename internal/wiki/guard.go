@@ -0,0 +1,121 @@
+package wiki
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// ViolationError reports files outside the wiki that an engine changed.
+type ViolationError struct {
+	WikiPath string
+	Paths    []string
+}
+
+func (e *ViolationError) Error() string {
+	return fmt.Sprintf("engine modified %d files outside %s (reverted): %s",
+		len(e.Paths), e.WikiPath, strings.Join(e.Paths, ", "))
+}
+
+// guard watches a working tree for engine changes outside the wiki.
+type guard struct {
+	gitRoot  string
+	dir      string
+	wikiPath string
+	files    snapshot               // files outside the wiki before the run
+	modes    map[string]os.FileMode // and their permissions
+}
+
+func startGuard(gitRoot string, dir string, wikiPath string) (*guard, error) {
+	g := &guard{gitRoot: gitRoot, dir: dir, wikiPath: wikiPath}
+	files, modes, err := g.scan()
+	if err != nil {
+		return nil, fmt.Errorf("scanning working tree: %w", err)
+	}
+	g.files, g.modes = files, modes
+	return g, nil
+}
+
+// scan reads the tracked files and the untracked files that aren't
+// ignored, outside the wiki and repowiki's own state directory. Symlinks
+// are left out; the engine's tools don't follow them.
+func (g *guard) scan() (snapshot, map[string]os.FileMode, error) {
+	paths, err := git.WorkTreeFiles(g.dir)
+	if err != nil {
+		return nil, nil, err
+	}
+	files := snapshot{}
+	modes := map[string]os.FileMode{}
+	for _, p := range paths {
+		if underDir(p, g.wikiPath) || underDir(p, config.ConfigDir) {
+			continue
+		}
+		abs := filepath.Join(g.dir, filepath.FromSlash(p))
+		fi, err := os.Lstat(abs)
+		if err != nil || !fi.Mode().IsRegular() {
+			continue // tracked but deleted, or not a plain file
+		}
+		data, err := os.ReadFile(abs)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[p] = data
+		modes[p] = fi.Mode().Perm()
+	}
+	return files, modes, nil
+}
+
+// check restores every file outside the wiki whose content changed since
+// startGuard, removes the ones added and brings back the ones deleted, and
+// reports them as a *ViolationError. Files whose content is unchanged
+// aren't flagged, even if they were touched.
+func (g *guard) check() error {
+	after, _, err := g.scan()
+	if err != nil {
+		return fmt.Errorf("scanning working tree: %w", err)
+	}
+	restore := after.diff(g.files)
+	if len(restore) == 0 {
+		return nil
+	}
+	paths := make([]string, len(restore))
+	for i, c := range restore {
+		paths[i] = c.Path
+	}
+
+	logf(g.gitRoot, "guardrail violation: engine modified %d files outside %s:", len(paths), g.wikiPath)
+	for _, p := range paths {
+		logf(g.gitRoot, "  %s", p)
+	}
+	if err := applyChanges(g.dir, restore); err != nil {
+		return fmt.Errorf("reverting engine changes outside %s: %w", g.wikiPath, err)
+	}
+	for _, c := range restore {
+		if !c.Deleted {
+			os.Chmod(filepath.Join(g.dir, filepath.FromSlash(c.Path)), g.modes[c.Path])
+		}
+	}
+	return &ViolationError{WikiPath: g.wikiPath, Paths: paths}
+}
+
+// joinViolation adds a guardrail failure to the engine's own error.
+func joinViolation(err error, verr error) error {
+	switch {
+	case verr == nil:
+		return err
+	case err == nil:
+		return verr
+	default:
+		return fmt.Errorf("%w; %w", err, verr)
+	}
+}
+
+// underDir reports whether the slash-separated path lies inside dir.
+func underDir(path string, dir string) bool {
+	dir = strings.Trim(filepath.ToSlash(dir), "/")
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
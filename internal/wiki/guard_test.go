@@ -0,0 +1,106 @@
+package wiki
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+// rogueEngine configures a command engine that writes a wiki page and also
+// edits main.go and creates notes.txt outside the wiki. extra runs after.
+func rogueEngine(sandbox bool, extra string) func(cfg *config.Config) {
+	return func(cfg *config.Config) {
+		cfg.Sandbox = &sandbox
+		cfg.Engines = map[string]config.EngineSettings{
+			"rogue": {Command: []string{"sh", "-c",
+				"mkdir -p .qoder/repowiki/en/content && echo page > .qoder/repowiki/en/content/Page.md && " +
+					"echo 'package evil' > main.go && echo notes > notes.txt" + extra}},
+		}
+	}
+}
+
+func (r *testRepo) useRogue(sandbox bool, extra string) {
+	r.t.Helper()
+	rogueEngine(sandbox, extra)(r.reload())
+	r.cfg.Engine = "rogue"
+	r.saveConfig()
+}
+
+func TestGuardRevertsEngineEdits(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n", "run.sh": "#!/bin/sh\n"}, nil)
+	r.generate()
+	os.Chmod(r.path("run.sh"), 0755)
+	// The engine also touches util.go without changing it.
+	r.useRogue(false, " && echo 'exit 1' >> run.sh && touch util.go")
+	r.write("util.go", "package main\n")
+	r.commit("add util")
+	// Uncommitted work from before the run.
+	r.write("util.go", "package main\n\nfunc Util() {}\n")
+	r.write("scratch.txt", "untracked user file\n")
+
+	err := r.update(nil)
+	var verr *ViolationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("update error = %v, want a ViolationError", err)
+	}
+	if want := []string{"main.go", "notes.txt", "run.sh"}; !slices.Equal(verr.Paths, want) {
+		t.Errorf("violations = %v, want %v", verr.Paths, want)
+	}
+	if got := r.read("main.go"); got != "package main\n" {
+		t.Errorf("main.go = %q, engine edit not reverted", got)
+	}
+	if r.exists("notes.txt") {
+		t.Errorf("file created by the engine was not removed")
+	}
+	if fi, err := os.Stat(r.path("run.sh")); err != nil || fi.Mode().Perm() != 0755 || r.read("run.sh") != "#!/bin/sh\n" {
+		t.Errorf("run.sh not restored with its content and mode")
+	}
+	if got := r.read("util.go"); got != "package main\n\nfunc Util() {}\n" {
+		t.Errorf("util.go = %q, uncommitted edit from before the run lost", got)
+	}
+	if got := r.read("scratch.txt"); got != "untracked user file\n" {
+		t.Errorf("scratch.txt = %q, untracked file from before the run lost", got)
+	}
+
+	// The snapshot must not add untracked files to the object database.
+	blob := r.git("hash-object", "scratch.txt")
+	if out, err := exec.Command("git", "-C", r.root, "cat-file", "-e", blob).CombinedOutput(); err == nil {
+		t.Errorf("untracked scratch.txt was written to the object database: %s", out)
+	}
+}
+
+func TestGuardIgnoresCheckoutEditsDuringSandboxedRun(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	// While the engine runs in the sandbox, the user edits the checkout.
+	r.useRogue(true, fmt.Sprintf(" && echo '// user edit' >> %s", r.path("util.go")))
+	r.write("util.go", "package main\n")
+	r.commit("add util")
+	wikiHead := r.head()
+
+	err := r.update(nil)
+	var verr *ViolationError
+	if !errors.As(err, &verr) {
+		t.Fatalf("update error = %v, want a ViolationError", err)
+	}
+	if want := []string{"main.go", "notes.txt"}; !slices.Equal(verr.Paths, want) {
+		t.Errorf("violations = %v, want only the engine's %v", verr.Paths, want)
+	}
+	if got := r.read("util.go"); got != "package main\n// user edit\n" {
+		t.Errorf("util.go = %q, concurrent user edit was touched", got)
+	}
+	if got := r.read("main.go"); got != "package main\n" {
+		t.Errorf("main.go = %q, sandbox changes leaked into the checkout", got)
+	}
+	if r.exists("notes.txt") || r.exists(".qoder/repowiki/en/content/Page.md") {
+		t.Errorf("files from the failed sandbox run were copied back")
+	}
+	if r.head() != wikiHead {
+		t.Errorf("failed run committed")
+	}
+}
@@ -0,0 +1,56 @@
+package wiki
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestPatchContainsOnlyTheRun(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	r.write("util.go", "package main\n")
+	source := r.commit("add util")
+
+	opts := &Options{Patch: filepath.Join(t.TempDir(), "wiki.patch")}
+	if err := r.update(opts); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+	if r.head() != source {
+		t.Errorf("patch mode committed %s", r.head())
+	}
+	if status := r.git("status", "--porcelain", "--", ".", ":!.repowiki"); status != "" {
+		t.Errorf("checkout not clean after writing the patch:\n%s", status)
+	}
+	data, err := os.ReadFile(opts.PatchFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	patch := string(data)
+	for _, want := range []string{"Subject: [PATCH] [repowiki] update wiki", "+++ b/" + r.page("util.go"), SourceTrailer + ": " + source} {
+		if !strings.Contains(patch, want) {
+			t.Errorf("patch does not contain %q:\n%s", want, patch)
+		}
+	}
+}
+
+func TestPatchRefusedOnDirtyWiki(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	r.write(r.page("main.go"), "# edited by hand\n")
+	r.write("util.go", "package main\n")
+	r.commit("add util")
+
+	opts := &Options{Patch: filepath.Join(t.TempDir(), "wiki.patch")}
+	err := r.update(opts)
+	if err == nil || !strings.Contains(err.Error(), "uncommitted changes") {
+		t.Fatalf("IncrementalUpdate error = %v, want a refusal over the uncommitted wiki edit", err)
+	}
+	if _, err := os.Stat(opts.Patch); !os.IsNotExist(err) {
+		t.Errorf("patch written despite the uncommitted wiki edit")
+	}
+	if got := r.read(r.page("main.go")); got != "# edited by hand\n" {
+		t.Errorf("uncommitted wiki edit lost: %q", got)
+	}
+}
@@ -0,0 +1,300 @@
+package wiki
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+const (
+	pendingDir  = "pending"
+	pendingFile = "changeset.json"
+)
+
+// Pending is a run's wiki changeset awaiting review, stored in
+// .repowiki/pending/<run-id>/changeset.json.
+type Pending struct {
+	ID          string        `json:"id"`
+	Created     string        `json:"created"`
+	From        string        `json:"from,omitempty"`   // last processed commit when the run started
+	Source      string        `json:"source,omitempty"` // the changeset documents From..Source
+	Description string        `json:"description"`
+	Engine      string        `json:"engine,omitempty"`
+	Model       string        `json:"model,omitempty"`
+	Files       []PendingFile `json:"files"`
+}
+
+// PendingFile is one file change plus the hash of the file it was made
+// against, to detect conflicts with later changes.
+type PendingFile struct {
+	FileChange
+	Base string `json:"base,omitempty"` // sha256 of the original file; empty if it didn't exist
+}
+
+func pendingPath(gitRoot string, id string) string {
+	return filepath.Join(config.Dir(gitRoot), pendingDir, id)
+}
+
+func contentHash(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// holdForReview saves the run's wiki changes as a pending changeset and
+// restores the wiki to how it was before the run. It returns the number of
+// files changed; nothing is saved if there are none.
+func holdForReview(gitRoot string, cfg *config.Config, runID string, info *CommitInfo, before snapshot) (int, error) {
+	changes := before.diff(takeSnapshot(gitRoot, cfg.WikiPath))
+	if len(changes) == 0 {
+		return 0, nil
+	}
+
+	p := &Pending{
+		ID:          runID,
+		Created:     time.Now().UTC().Format(time.RFC3339),
+		From:        cfg.LastCommitHash,
+		Source:      info.Source,
+		Description: info.Description,
+		Engine:      info.Engine,
+		Model:       info.Model,
+	}
+	var restore []FileChange
+	for _, c := range changes {
+		f := PendingFile{FileChange: c}
+		if old, ok := before[c.Path]; ok {
+			f.Base = contentHash(old)
+			restore = append(restore, FileChange{Path: c.Path, Content: old})
+		} else {
+			restore = append(restore, FileChange{Path: c.Path, Deleted: true})
+		}
+		p.Files = append(p.Files, f)
+	}
+
+	dir := pendingPath(gitRoot, runID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return 0, fmt.Errorf("failed to create pending dir: %w", err)
+	}
+	data, err := json.MarshalIndent(p, "", "  ")
+	if err != nil {
+		return 0, fmt.Errorf("failed to marshal changeset: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, pendingFile), append(data, '\n'), 0644); err != nil {
+		return 0, fmt.Errorf("failed to write changeset: %w", err)
+	}
+	return len(changes), applyChanges(gitRoot, restore)
+}
+
+// ListPending returns the pending changesets, oldest first.
+func ListPending(gitRoot string) ([]*Pending, error) {
+	entries, err := os.ReadDir(filepath.Join(config.Dir(gitRoot), pendingDir))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var list []*Pending
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		p, err := loadPending(gitRoot, e.Name())
+		if err != nil {
+			continue
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].ID < list[j].ID })
+	return list, nil
+}
+
+// FindPending returns the pending changeset whose ID is id or starts with
+// it.
+func FindPending(gitRoot string, id string) (*Pending, error) {
+	list, err := ListPending(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	var match *Pending
+	for _, p := range list {
+		if p.ID == id {
+			return p, nil
+		}
+		if strings.HasPrefix(p.ID, id) {
+			if match != nil {
+				return nil, fmt.Errorf("changeset %q is ambiguous", id)
+			}
+			match = p
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("no pending changeset %q", id)
+	}
+	return match, nil
+}
+
+func loadPending(gitRoot string, id string) (*Pending, error) {
+	data, err := os.ReadFile(filepath.Join(pendingPath(gitRoot, id), pendingFile))
+	if err != nil {
+		return nil, err
+	}
+	var p Pending
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("failed to parse changeset %s: %w", id, err)
+	}
+	return &p, nil
+}
+
+// Conflicts lists the files that changed in the working tree since the
+// changeset was made, which accepting it would overwrite.
+func (p *Pending) Conflicts(gitRoot string) []string {
+	var paths []string
+	for _, f := range p.Files {
+		current := ""
+		if data, err := os.ReadFile(filepath.Join(gitRoot, filepath.FromSlash(f.Path))); err == nil {
+			current = contentHash(data)
+		}
+		if current != f.Base {
+			paths = append(paths, f.Path)
+		}
+	}
+	return paths
+}
+
+// Diff writes a unified diff from the working tree to the changeset.
+func (p *Pending) Diff(gitRoot string, w io.Writer) error {
+	tmp, err := os.MkdirTemp("", "repowiki-review-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	// Lay out both sides as a/<path> and b/<path> so the diff reads like
+	// git's own.
+	var current, proposed []FileChange
+	for _, f := range p.Files {
+		if data, err := os.ReadFile(filepath.Join(gitRoot, filepath.FromSlash(f.Path))); err == nil {
+			current = append(current, FileChange{Path: f.Path, Content: data})
+		}
+		if !f.Deleted {
+			proposed = append(proposed, f.FileChange)
+		}
+	}
+	for side, changes := range map[string][]FileChange{"a": current, "b": proposed} {
+		if err := os.MkdirAll(filepath.Join(tmp, side), 0755); err != nil {
+			return err
+		}
+		if err := applyChanges(filepath.Join(tmp, side), changes); err != nil {
+			return err
+		}
+	}
+
+	cmd := exec.Command("git", "diff", "--no-index", "--no-prefix", "--", "a", "b")
+	cmd.Dir = tmp
+	cmd.Stdout = w
+	cmd.Stderr = os.Stderr
+	// Exit status 1 just means the sides differ.
+	if err := cmd.Run(); err != nil {
+		if exitErr, ok := err.(*exec.ExitError); !ok || exitErr.ExitCode() != 1 {
+			return fmt.Errorf("git diff: %w", err)
+		}
+	}
+	return nil
+}
+
+// AcceptPending applies a changeset to the working tree and commits it,
+// pushing the commit if configured. Unless force is set, it refuses if the
+// files changed since the changeset was made. The source commits it
+// documents become processed, and pending changesets covering only
+// commits up to them are dropped, since later runs redid their work.
+func AcceptPending(gitRoot string, cfg *config.Config, p *Pending, force bool) error {
+	if err := lock(gitRoot); err != nil {
+		return fmt.Errorf("cannot acquire lock: %w", err)
+	}
+	defer unlock(gitRoot)
+
+	if _, err := os.Stat(pendingPath(gitRoot, p.ID)); err != nil {
+		return fmt.Errorf("changeset %s is no longer pending", p.ID)
+	}
+	if conflicts := p.Conflicts(gitRoot); len(conflicts) > 0 && !force {
+		return fmt.Errorf("wiki files changed since %s was made: %s", p.ID, strings.Join(conflicts, ", "))
+	}
+
+	changes := make([]FileChange, len(p.Files))
+	for i, f := range p.Files {
+		changes[i] = f.FileChange
+	}
+	if err := checkChanges(changes, cfg.WikiPath); err != nil {
+		return fmt.Errorf("invalid changeset %s: %w", p.ID, err)
+	}
+	if err := applyChanges(gitRoot, changes); err != nil {
+		return fmt.Errorf("failed to apply changeset: %w", err)
+	}
+	saved, err := config.Load(gitRoot)
+	if err != nil {
+		return err
+	}
+	if covers(gitRoot, p.Source, saved.LastCommitHash) {
+		if err := config.UpdateLastRun(gitRoot, p.Source); err != nil {
+			return err
+		}
+	}
+
+	info := &CommitInfo{
+		Source:      p.Source,
+		Description: p.Description,
+		Engine:      p.Engine,
+		Model:       p.Model,
+	}
+	commit, err := CommitChanges(gitRoot, cfg, info)
+	if err != nil {
+		return err
+	}
+	logf(gitRoot, "accepted changeset %s", p.ID)
+	if err := os.RemoveAll(pendingPath(gitRoot, p.ID)); err != nil {
+		return err
+	}
+	dropSuperseded(gitRoot, p)
+	if cfg.AutoPush && commit != "" {
+		return push(gitRoot, cfg)
+	}
+	return nil
+}
+
+// covers reports whether source is last or comes after it.
+func covers(gitRoot string, source string, last string) bool {
+	return source != "" && (last == "" || git.IsAncestor(gitRoot, last, source))
+}
+
+// dropSuperseded removes the changesets made from the same starting point
+// as accepted for source commits it also documents.
+func dropSuperseded(gitRoot string, accepted *Pending) {
+	list, err := ListPending(gitRoot)
+	if err != nil {
+		return
+	}
+	for _, p := range list {
+		if p.From == accepted.From && covers(gitRoot, accepted.Source, p.Source) {
+			logf(gitRoot, "dropped changeset %s, superseded by %s", p.ID, accepted.ID)
+			os.RemoveAll(pendingPath(gitRoot, p.ID))
+		}
+	}
+}
+
+// RejectPending discards a changeset. The source commits it documents stay
+// unprocessed, so the next update covers them again.
+func RejectPending(gitRoot string, p *Pending) error {
+	logf(gitRoot, "rejected changeset %s", p.ID)
+	return os.RemoveAll(pendingPath(gitRoot, p.ID))
+}
@@ -0,0 +1,171 @@
+package wiki
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+// heldChangeset commits a new source file in review mode and returns the
+// changeset held for it.
+func heldChangeset(t *testing.T, r *testRepo, file string) *Pending {
+	t.Helper()
+	r.write(file, "package main\n")
+	source := r.commit("add " + file)
+	if err := r.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+	if r.head() != source {
+		t.Fatalf("review mode committed %s", r.head())
+	}
+	if r.exists(r.page(file)) {
+		t.Fatalf("review mode left %s in the working tree", r.page(file))
+	}
+	pending, err := ListPending(r.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range pending {
+		if p.Source == source {
+			return p
+		}
+	}
+	t.Fatalf("no changeset held for %s", source)
+	return nil
+}
+
+func TestReviewAcceptAndReject(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	r.reload().Review = true
+	r.saveConfig()
+	processed := r.cfg.LastCommitHash
+
+	p := heldChangeset(t, r, "util.go")
+	if last := r.reload().LastCommitHash; last != processed {
+		t.Errorf("LastCommitHash = %s while the changeset is pending, want %s", last, processed)
+	}
+	var diff bytes.Buffer
+	if err := p.Diff(r.root, &diff); err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	if !strings.Contains(diff.String(), "+# util.go") {
+		t.Errorf("diff does not add the util.go page:\n%s", diff.String())
+	}
+
+	if err := AcceptPending(r.root, r.reload(), p, false); err != nil {
+		t.Fatalf("AcceptPending: %v", err)
+	}
+	if !strings.HasPrefix(r.git("log", "-1", "--format=%s"), "[repowiki] ") {
+		t.Errorf("accepting did not make a wiki commit")
+	}
+	if !strings.Contains(r.git("show", "--name-only", "--format=", "HEAD"), r.page("util.go")) {
+		t.Errorf("wiki commit does not contain %s", r.page("util.go"))
+	}
+	if last := r.reload().LastCommitHash; last != p.Source {
+		t.Errorf("LastCommitHash = %s after accepting, want %s", last, p.Source)
+	}
+	if _, err := FindPending(r.root, p.ID); err == nil {
+		t.Errorf("accepted changeset %s is still pending", p.ID)
+	}
+
+	processed = p.Source
+	p = heldChangeset(t, r, "num.go")
+	if err := RejectPending(r.root, p); err != nil {
+		t.Fatalf("RejectPending: %v", err)
+	}
+	if pending, _ := ListPending(r.root); len(pending) != 0 {
+		t.Errorf("%d changesets pending after reject, want 0", len(pending))
+	}
+	if r.exists(r.page("num.go")) {
+		t.Errorf("rejected page %s was written", r.page("num.go"))
+	}
+	if last := r.reload().LastCommitHash; last != processed {
+		t.Errorf("LastCommitHash = %s after rejecting, want %s", last, processed)
+	}
+
+	// The rejected source commit is covered again by the next run.
+	if err := r.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+	pending, err := ListPending(r.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 1 || !pendingHas(pending[0], r.page("num.go")) {
+		t.Errorf("update after reject did not redo num.go")
+	}
+}
+
+func TestReviewAcceptDropsSuperseded(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, func(cfg *config.Config) {
+		cfg.Review = true
+	})
+	r.generate()
+	first, err := ListPending(r.root)
+	if err != nil || len(first) != 1 {
+		t.Fatalf("first generation not held: %v", err)
+	}
+	if err := AcceptPending(r.root, r.reload(), first[0], false); err != nil {
+		t.Fatalf("AcceptPending: %v", err)
+	}
+
+	a := heldChangeset(t, r, "a.go")
+	b := heldChangeset(t, r, "b.go")
+	if !pendingHas(b, r.page("a.go")) {
+		t.Errorf("second run did not cover a.go again")
+	}
+	if err := AcceptPending(r.root, r.reload(), b, false); err != nil {
+		t.Fatalf("AcceptPending: %v", err)
+	}
+	if _, err := FindPending(r.root, a.ID); err == nil {
+		t.Errorf("superseded changeset %s is still pending", a.ID)
+	}
+	if err := AcceptPending(r.root, r.reload(), a, true); err == nil {
+		t.Errorf("force-accepting the superseded changeset succeeded")
+	}
+	if last := r.reload().LastCommitHash; last != b.Source {
+		t.Errorf("LastCommitHash = %s, want %s", last, b.Source)
+	}
+	if !r.exists(r.page("a.go")) || !r.exists(r.page("b.go")) {
+		t.Errorf("accepted changeset did not write both pages")
+	}
+}
+
+// pendingHas reports whether p changes path.
+func pendingHas(p *Pending, path string) bool {
+	for _, f := range p.Files {
+		if f.Path == path {
+			return true
+		}
+	}
+	return false
+}
+
+func TestReviewAcceptRefusesConflicts(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	r.reload().Review = true
+	r.saveConfig()
+
+	p := heldChangeset(t, r, "util.go")
+	r.write(r.page("util.go"), "# written by hand\n")
+	if got := p.Conflicts(r.root); len(got) != 1 || got[0] != r.page("util.go") {
+		t.Errorf("Conflicts = %v, want [%s]", got, r.page("util.go"))
+	}
+	if err := AcceptPending(r.root, r.reload(), p, false); err == nil {
+		t.Fatalf("AcceptPending over a hand edit succeeded")
+	}
+	if got := r.read(r.page("util.go")); got != "# written by hand\n" {
+		t.Errorf("refused accept overwrote the hand edit: %q", got)
+	}
+
+	if err := AcceptPending(r.root, r.reload(), p, true); err != nil {
+		t.Fatalf("AcceptPending with force: %v", err)
+	}
+	if got := r.read(r.page("util.go")); !strings.Contains(got, "# util.go") {
+		t.Errorf("forced accept did not write the changeset: %q", got)
+	}
+}
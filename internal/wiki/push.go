@@ -0,0 +1,114 @@
+package wiki
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// push pushes the wiki commits, logging the outcome.
+func push(gitRoot string, cfg *config.Config) error {
+	if err := pushWiki(gitRoot, cfg); err != nil {
+		logf(gitRoot, "push failed: %v", err)
+		return fmt.Errorf("wiki committed but not pushed: %w", err)
+	}
+	logf(gitRoot, "wiki commits pushed to %s", cfg.PushTo())
+	return nil
+}
+
+// maxPushAttempts bounds pushes retried after the remote moved on.
+const maxPushAttempts = 3
+
+// pushWiki pushes the branch holding the wiki commits. If the remote has
+// moved on, the unpushed commits are rebuilt on its new tip and the push is
+// retried, unless both sides changed the same files.
+func pushWiki(gitRoot string, cfg *config.Config) error {
+	ref := commitRequest(gitRoot, cfg, nil).Ref
+	refspec := cfg.PushRefspec
+	if refspec == "" {
+		branch := cfg.WikiBranchRef()
+		if !cfg.UsesWikiBranch() {
+			if branch = git.CurrentBranch(gitRoot); branch == "" {
+				return fmt.Errorf("HEAD is detached; set push_refspec to push wiki commits")
+			}
+		}
+		refspec = branch + ":" + branch
+	}
+	src, dst, ok := strings.Cut(strings.TrimPrefix(refspec, "+"), ":")
+	if !ok {
+		dst = src
+	}
+	remote := cfg.PushTo()
+
+	for attempt := 1; ; attempt++ {
+		err := git.Push(gitRoot, remote, refspec)
+		if !errors.Is(err, git.ErrPushRejected) || attempt == maxPushAttempts {
+			return err
+		}
+		logf(gitRoot, "push of %s to %s rejected, rebasing wiki commits onto the remote tip", dst, remote)
+		if err := rebaseOntoRemote(gitRoot, cfg, ref, remote, dst); err != nil {
+			return err
+		}
+	}
+}
+
+// rebaseOntoRemote rebuilds the commits on ref that remote's dst doesn't
+// have on top of it. With commit storage they must all be wiki commits:
+// the user's own unpushed commits are left for them to pull and push.
+// Commits already on another remote-tracking branch, merges, and files
+// changed on both sides stop it. For the working branch, the index and
+// working tree follow, picking up the remote's changes.
+func rebaseOntoRemote(gitRoot string, cfg *config.Config, ref string, remote string, dst string) error {
+	tip, err := git.FetchRef(gitRoot, remote, dst)
+	if err != nil {
+		return err
+	}
+	local := git.ResolveRef(gitRoot, ref)
+	commits, err := git.CommitsBetween(gitRoot, tip, local)
+	if err != nil || len(commits) == 0 {
+		return err
+	}
+	isWiki := func(msg string) bool { return strings.HasPrefix(msg, cfg.CommitPrefix) }
+	if !cfg.UsesWikiBranch() {
+		for _, c := range commits {
+			msg, err := git.CommitMessage(gitRoot, c)
+			if err != nil {
+				return err
+			}
+			if !isWiki(msg) {
+				return fmt.Errorf("unpushed commit %s is not a wiki commit; pull and push manually", c)
+			}
+		}
+	}
+	unpushed, err := git.UnpushedCommits(gitRoot, ref)
+	if err != nil {
+		return err
+	}
+	movable := map[string]bool{}
+	for _, e := range unpushed {
+		movable[e.Hash] = true
+	}
+	for _, c := range commits {
+		if !movable[c] {
+			return fmt.Errorf("commit %s is already on another remote branch; pull and push manually", c)
+		}
+	}
+
+	rebased, err := git.RebaseCommits(gitRoot, commits, tip, commitRequest(gitRoot, cfg, nil), isWiki)
+	if err != nil {
+		if errors.Is(err, git.ErrRebaseConflict) {
+			return fmt.Errorf("%w; pull and push manually", err)
+		}
+		return fmt.Errorf("failed to rebase wiki commits: %w", err)
+	}
+	if ref == "HEAD" {
+		if err := git.SwitchTree(gitRoot, local, rebased); err != nil {
+			return fmt.Errorf("cannot move working tree onto %s: %w", remote, err)
+		}
+	}
+	logf(gitRoot, "rebased %d wiki commits onto %s %s", len(commits), remote, tip)
+	return git.UpdateRef(gitRoot, ref, rebased, local, "repowiki: rebase wiki commits onto "+remote)
+}
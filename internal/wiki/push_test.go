@@ -0,0 +1,125 @@
+package wiki
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// pushedRepo returns a test repo with auto-push to a local bare origin, and
+// a second clone of origin to push competing commits from.
+func pushedRepo(t *testing.T) (r *testRepo, other string) {
+	t.Helper()
+	r = newTestRepo(t, map[string]string{"main.go": "package main\n"}, func(cfg *config.Config) {
+		cfg.AutoPush = true
+	})
+	origin := filepath.Join(t.TempDir(), "origin.git")
+	r.git("init", "-q", "--bare", "-b", "main", origin)
+	r.git("remote", "add", "origin", origin)
+	r.git("push", "-q", "-u", "origin", "main")
+	r.generate()
+
+	other = filepath.Join(t.TempDir(), "other")
+	r.git("clone", "-q", origin, other)
+	return r, other
+}
+
+func TestPushRebasesOntoRemote(t *testing.T) {
+	r, other := pushedRepo(t)
+	r.write("util.go", "package main\n")
+	source := r.commit("add util")
+	r.git("push", "-q", "origin", "main")
+	runGit(t, other, "pull", "-q", "origin", "main")
+	commitIn(t, other, "other.go", "add other")
+	runGit(t, other, "push", "-q", "origin", "main")
+	remoteTip := runGit(t, other, "rev-parse", "HEAD")
+
+	if err := r.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+
+	if got := r.git("rev-parse", "origin/main"); got != r.head() {
+		t.Fatalf("origin/main = %s, want the local HEAD %s", got, r.head())
+	}
+	log := strings.Split(r.git("log", "--format=%H %s", "-2"), "\n")
+	if !strings.Contains(log[0], "[repowiki] ") || !strings.HasPrefix(log[1], remoteTip) {
+		t.Errorf("history after the push =\n%s\nwant the wiki commit on %s", strings.Join(log, "\n"), remoteTip)
+	}
+	trailers, err := git.Trailers(r.root, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(trailers[SourceTrailer]) != 1 || trailers[SourceTrailer][0] != source {
+		t.Errorf("%s = %v, want %s", SourceTrailer, trailers[SourceTrailer], source)
+	}
+	if !r.exists("other.go") {
+		t.Errorf("working tree did not pick up the remote's other.go")
+	}
+	if status := r.git("status", "--porcelain", "--", ".", ":!.repowiki"); status != "" {
+		t.Errorf("working tree not clean after the rebase:\n%s", status)
+	}
+}
+
+func TestPushLeavesUnpushedSourceCommits(t *testing.T) {
+	r, other := pushedRepo(t)
+	commitIn(t, other, "other.go", "add other")
+	runGit(t, other, "push", "-q", "origin", "main")
+	remoteTip := runGit(t, other, "rev-parse", "HEAD")
+
+	r.write("util.go", "package main\n")
+	source := r.commit("add util")
+	err := r.update(nil)
+	if err == nil || !strings.Contains(err.Error(), source+" is not a wiki commit") {
+		t.Fatalf("IncrementalUpdate error = %v, want a refusal to rebase %s", err, source)
+	}
+	if got := r.git("rev-parse", "HEAD~1"); got != source {
+		t.Errorf("HEAD~1 = %s, want the untouched source commit %s", got, source)
+	}
+	if !strings.HasPrefix(r.git("log", "-1", "--format=%s"), "[repowiki] ") {
+		t.Errorf("wiki commit was not kept locally")
+	}
+	if got := r.git("rev-parse", "origin/main"); got != remoteTip {
+		t.Errorf("origin/main = %s, want the remote's %s", got, remoteTip)
+	}
+	if r.exists("other.go") {
+		t.Errorf("working tree was moved onto the remote")
+	}
+}
+
+func TestPushRefusesConflictingRebase(t *testing.T) {
+	r, other := pushedRepo(t)
+	r.write("main.go", "package main\n\nfunc main() {}\n")
+	r.commit("change main")
+	r.git("push", "-q", "origin", "main")
+	runGit(t, other, "pull", "-q", "origin", "main")
+	meta := filepath.ToSlash(filepath.Join(r.cfg.WikiPath, r.cfg.Language, "meta", "repowiki-metadata.json"))
+	theirs := &testRepo{t: t, root: other}
+	theirs.write(meta, "edit the metadata\n")
+	runGit(t, other, "commit", "-qam", "edit the metadata")
+	runGit(t, other, "push", "-q", "origin", "main")
+
+	err := r.update(nil)
+	if err == nil || !strings.Contains(err.Error(), "rebase conflict") {
+		t.Fatalf("IncrementalUpdate error = %v, want a rebase conflict", err)
+	}
+	if !strings.HasPrefix(r.git("log", "-1", "--format=%s"), "[repowiki] ") {
+		t.Errorf("wiki commit was not kept locally")
+	}
+	if r.git("rev-parse", "origin/main") == r.head() {
+		t.Errorf("conflicting commits were pushed")
+	}
+	if got := r.read(meta); strings.Contains(got, "edit the metadata") {
+		t.Errorf("%s = %q, local wiki replaced by the remote's", meta, got)
+	}
+}
+
+// commitIn writes path in the repository at dir and commits it with msg.
+func commitIn(t *testing.T, dir string, path string, msg string) {
+	t.Helper()
+	r := &testRepo{t: t, root: dir}
+	r.write(path, "package main // "+msg+"\n")
+	r.commit(msg)
+}
@@ -0,0 +1,157 @@
+package wiki
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/budget"
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/lockfile"
+)
+
+// rewrittenFile queues "old new" commit pairs reported while another
+// process held the lock.
+const rewrittenFile = "rewritten"
+
+// RemapCommits follows source commits that were rewritten (by an amend or
+// a rebase) in the budget queue and cfg, and saves cfg if it changed.
+// rewritten maps old commits to new ones. The caller holds the lock.
+func RemapCommits(gitRoot string, cfg *config.Config, rewritten map[string]string) error {
+	budget.Remap(gitRoot, rewritten)
+
+	// Follow the last processed commit if the rewrite kept its tree.
+	// Otherwise fall back to where the rewrite started, so the next update
+	// picks up what it changed from a commit git keeps.
+	last := cfg.LastCommitHash
+	changed := false
+	if c, ok := rewritten[last]; ok {
+		if !git.SameTree(gitRoot, last, c) {
+			c = rewriteBase(gitRoot, last, c)
+		}
+		cfg.LastCommitHash = c
+		changed = true
+	}
+	if r := cfg.NoRegenerate; r != nil {
+		if r.From == last && cfg.LastCommitHash != last {
+			r.From = cfg.LastCommitHash
+			changed = true
+		}
+		if c, ok := rewritten[r.To]; ok {
+			r.To = c
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return config.Save(gitRoot, cfg)
+}
+
+// rewriteBase returns a commit reachable from HEAD from which the changes
+// of old's rewrite to c can be redone: the merge base of old and HEAD,
+// else c's parent, else the empty tree.
+func rewriteBase(gitRoot string, old string, c string) string {
+	if head, err := git.HeadCommit(gitRoot); err == nil {
+		if base, err := git.MergeBase(gitRoot, old, head); err == nil {
+			return base
+		}
+	}
+	if parents, err := git.Parents(gitRoot, c); err == nil && len(parents) > 0 {
+		return parents[0]
+	}
+	return git.EmptyTree(gitRoot)
+}
+
+// RemapRewritten follows rewritten commits like RemapCommits. If another
+// process holds the lock, the mapping is queued for it to apply once it
+// has saved its progress, before it releases the lock; it reports whether
+// the mapping was applied now.
+func RemapRewritten(gitRoot string, rewritten map[string]string) (bool, error) {
+	// Queue first: a holder releasing the lock meanwhile still sees it.
+	if err := queueRewritten(gitRoot, rewritten); err != nil {
+		return false, err
+	}
+	if err := lockfile.Acquire(gitRoot); err != nil {
+		return false, nil
+	}
+	defer lockfile.Release(gitRoot)
+	return true, applyRewritten(gitRoot)
+}
+
+func queueRewritten(gitRoot string, rewritten map[string]string) error {
+	if err := os.MkdirAll(config.Dir(gitRoot), 0755); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for old, c := range rewritten {
+		fmt.Fprintf(&b, "%s %s\n", old, c)
+	}
+	f, err := os.OpenFile(filepath.Join(config.Dir(gitRoot), rewrittenFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to queue rewritten commits: %w", err)
+	}
+	defer f.Close()
+	_, err = f.WriteString(b.String())
+	return err
+}
+
+// applyRewritten remaps the queued rewritten commits, in the order they
+// were rewritten, and clears the queue. The caller holds the lock.
+func applyRewritten(gitRoot string) error {
+	path := filepath.Join(config.Dir(gitRoot), rewrittenFile)
+	// Take the queue over first, so pairs queued meanwhile aren't lost.
+	taken := path + ".applying"
+	if err := os.Rename(path, taken); err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer os.Remove(taken)
+	f, err := os.Open(taken)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	cfg, err := config.Load(gitRoot)
+	if err != nil {
+		return err
+	}
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		old, c, ok := strings.Cut(sc.Text(), " ")
+		if !ok {
+			continue
+		}
+		if err := RemapCommits(gitRoot, cfg, map[string]string{old: c}); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
+
+// lock takes the lock, catching up with rewrites queued while a process
+// that didn't apply them held it.
+func lock(gitRoot string) error {
+	if err := lockfile.Acquire(gitRoot); err != nil {
+		return err
+	}
+	if err := applyRewritten(gitRoot); err != nil {
+		logf(gitRoot, "remapping rewritten commits failed: %v", err)
+	}
+	return nil
+}
+
+// unlock applies the rewrites queued while the lock was held, now that
+// the run's progress is saved, and releases the lock.
+func unlock(gitRoot string) {
+	if err := applyRewritten(gitRoot); err != nil {
+		logf(gitRoot, "remapping rewritten commits failed: %v", err)
+	}
+	lockfile.Release(gitRoot)
+}
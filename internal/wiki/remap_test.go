@@ -0,0 +1,124 @@
+package wiki
+
+import (
+	"os"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/budget"
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/lockfile"
+)
+
+func TestRemapCommits(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	source := updateEach(t, r, "a.go")[0]
+
+	// Reword the source commit: same tree, new hash.
+	reworded := r.git("commit-tree", source+"^{tree}", "-p", source+"~1", "-m", "add a.go, reworded")
+	// Amend its content: new tree.
+	amended := r.git("commit-tree", r.head()+"^{tree}", "-p", source+"~1", "-m", "add a.go, amended")
+
+	cfg := r.reload()
+	cfg.NoRegenerate = &config.SourceRange{From: source, To: source}
+	if err := budget.Enqueue(r.root, source, "test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemapCommits(r.root, cfg, map[string]string{source: reworded}); err != nil {
+		t.Fatalf("RemapCommits: %v", err)
+	}
+	cfg = r.reload()
+	if cfg.LastCommitHash != reworded {
+		t.Errorf("LastCommitHash = %s, want the reworded %s", cfg.LastCommitHash, reworded)
+	}
+	if nr := cfg.NoRegenerate; nr.From != reworded || nr.To != reworded {
+		t.Errorf("NoRegenerate = %+v, want %s..%s", nr, reworded, reworded)
+	}
+	q, err := budget.LoadQueue(r.root)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(q) != 1 || q[0].Commit != reworded {
+		t.Errorf("queue = %+v, want only %s", q, reworded)
+	}
+
+	// A content change falls back to where the rewrite started, so the
+	// next update sees it.
+	if err := RemapCommits(r.root, cfg, map[string]string{reworded: amended}); err != nil {
+		t.Fatalf("RemapCommits: %v", err)
+	}
+	cfg = r.reload()
+	base := r.git("rev-parse", source+"~1")
+	if cfg.LastCommitHash != base {
+		t.Errorf("LastCommitHash = %s after a content amend, want the merge base %s", cfg.LastCommitHash, base)
+	}
+	if nr := cfg.NoRegenerate; nr.From != base || nr.To != amended {
+		t.Errorf("NoRegenerate = %+v, want %s..%s", nr, base, amended)
+	}
+}
+
+func TestRemapSurvivesGC(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	source := updateEach(t, r, "a.go")[0]
+	wikiCommit := r.head()
+
+	// Rewrite the source commit's content below the wiki commit, as an
+	// interactive rebase would.
+	r.git("reset", "-q", "--hard", source)
+	r.write("a.go", "package main\n\nfunc a() {}\n")
+	r.git("commit", "-q", "-a", "--amend", "--no-edit")
+	amended := r.head()
+	r.git("cherry-pick", "--allow-empty", wikiCommit)
+	applied, err := RemapRewritten(r.root, map[string]string{source: amended, wikiCommit: r.head()})
+	if err != nil || !applied {
+		t.Fatalf("RemapRewritten = %v, %v; want it applied", applied, err)
+	}
+	r.git("reflog", "expire", "--expire=now", "--all")
+	os.Remove(r.path(".git/ORIG_HEAD"))
+	r.git("gc", "-q", "--prune=now")
+	if _, err := git.Parents(r.root, source); err == nil {
+		t.Fatalf("gc kept the old source commit %s", source)
+	}
+
+	if last := r.reload().LastCommitHash; !git.IsAncestor(r.root, last, r.head()) {
+		t.Errorf("LastCommitHash = %s is not on HEAD", last)
+	}
+	if err := r.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate after gc: %v", err)
+	}
+	if last := r.reload().LastCommitHash; last != r.git("rev-parse", "HEAD~1") {
+		t.Errorf("LastCommitHash = %s after the update, want the commit it ran at", last)
+	}
+}
+
+func TestRemapQueuedWhileLocked(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	source := updateEach(t, r, "a.go")[0]
+	reworded := r.git("commit-tree", source+"^{tree}", "-p", source+"~1", "-m", "add a.go, reworded")
+
+	if err := lockfile.Acquire(r.root); err != nil {
+		t.Fatal(err)
+	}
+	applied, err := RemapRewritten(r.root, map[string]string{source: reworded})
+	if err != nil || applied {
+		t.Fatalf("RemapRewritten under a held lock = %v, %v; want it queued", applied, err)
+	}
+	if last := r.reload().LastCommitHash; last != source {
+		t.Errorf("LastCommitHash = %s while locked, want %s untouched", last, source)
+	}
+
+	// The holder applies the queue when it releases the lock.
+	unlock(r.root)
+	if last := r.reload().LastCommitHash; last != reworded {
+		t.Errorf("LastCommitHash = %s after unlock, want %s", last, reworded)
+	}
+	if lockfile.IsLocked(r.root) {
+		t.Errorf("lock still held")
+	}
+	if r.exists(".repowiki/" + rewrittenFile) {
+		t.Errorf("queue not cleared")
+	}
+}
@@ -0,0 +1,166 @@
+package wiki
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// testRepo is a scratch git repository with repowiki enabled on the fake
+// engine.
+type testRepo struct {
+	t    *testing.T
+	root string
+	cfg  *config.Config
+}
+
+// newTestRepo creates a repository with one commit of files and a saved
+// config. setup, if given, adjusts the config before it is saved.
+func newTestRepo(t *testing.T, files map[string]string, setup func(cfg *config.Config)) *testRepo {
+	t.Helper()
+	isolateGit(t)
+	r := &testRepo{t: t, root: t.TempDir()}
+	r.git("init", "-q", "-b", "main")
+	for path, content := range files {
+		r.write(path, content)
+	}
+	r.commit("init")
+
+	r.cfg = config.Default()
+	r.cfg.Enabled = true
+	r.cfg.Engine = config.EngineFake
+	if setup != nil {
+		setup(r.cfg)
+	}
+	r.saveConfig()
+	return r
+}
+
+// isolateGit keeps the user's git config and identity out of the tests.
+func isolateGit(t *testing.T) {
+	t.Helper()
+	for k, v := range map[string]string{
+		"GIT_CONFIG_GLOBAL":   os.DevNull,
+		"GIT_CONFIG_NOSYSTEM": "1",
+		"GIT_AUTHOR_NAME":     "Dev",
+		"GIT_AUTHOR_EMAIL":    "dev@example.com",
+		"GIT_COMMITTER_NAME":  "Dev",
+		"GIT_COMMITTER_EMAIL": "dev@example.com",
+	} {
+		t.Setenv(k, v)
+	}
+	// t.Setenv restores the variables after the test; unset them for it.
+	for _, k := range []string{"GIT_INDEX_FILE", "GIT_DIR"} {
+		t.Setenv(k, "")
+		os.Unsetenv(k)
+	}
+}
+
+func (r *testRepo) git(args ...string) string {
+	r.t.Helper()
+	return runGit(r.t, r.root, args...)
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %v\n%s", strings.Join(args, " "), err, out)
+	}
+	return strings.TrimSpace(string(out))
+}
+
+func (r *testRepo) path(rel string) string {
+	return filepath.Join(r.root, filepath.FromSlash(rel))
+}
+
+func (r *testRepo) write(rel string, content string) {
+	r.t.Helper()
+	p := r.path(rel)
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		r.t.Fatal(err)
+	}
+	if err := os.WriteFile(p, []byte(content), 0644); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+func (r *testRepo) read(rel string) string {
+	r.t.Helper()
+	data, err := os.ReadFile(r.path(rel))
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	return string(data)
+}
+
+func (r *testRepo) exists(rel string) bool {
+	_, err := os.Lstat(r.path(rel))
+	return err == nil
+}
+
+// commit commits all source changes (not the wiki or repowiki state) and
+// returns the new HEAD.
+func (r *testRepo) commit(msg string) string {
+	r.t.Helper()
+	r.git("add", "-A", "--", ".", ":!.qoder", ":!.repowiki")
+	r.git("commit", "-q", "--allow-empty", "-m", msg)
+	return r.head()
+}
+
+func (r *testRepo) head() string {
+	r.t.Helper()
+	return r.git("rev-parse", "HEAD")
+}
+
+func (r *testRepo) saveConfig() {
+	r.t.Helper()
+	if err := config.Save(r.root, r.cfg); err != nil {
+		r.t.Fatal(err)
+	}
+}
+
+// reload reads the config back, as the next run would.
+func (r *testRepo) reload() *config.Config {
+	r.t.Helper()
+	cfg, err := config.Load(r.root)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	r.cfg = cfg
+	return cfg
+}
+
+// page is the path of the fake engine's page for a source file.
+func (r *testRepo) page(source string) string {
+	return filepath.ToSlash(filepath.Join(r.cfg.WikiPath, r.cfg.Language, "content", "Files", source+".md"))
+}
+
+// generate runs a full generation at HEAD.
+func (r *testRepo) generate() {
+	r.t.Helper()
+	if err := FullGenerate(context.Background(), r.root, r.reload(), r.head(), nil); err != nil {
+		r.t.Fatalf("FullGenerate: %v", err)
+	}
+}
+
+// update runs an incremental update of HEAD for the changes since the
+// last run, as the hook would.
+func (r *testRepo) update(opts *Options) error {
+	r.t.Helper()
+	cfg := r.reload()
+	files, err := git.ChangedFilesSince(r.root, cfg.LastCommitHash)
+	if err != nil {
+		r.t.Fatal(err)
+	}
+	files = FilterExcluded(files, cfg.ExcludedPaths)
+	return IncrementalUpdate(context.Background(), r.root, cfg, files, r.head(), opts)
+}
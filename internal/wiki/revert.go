@@ -0,0 +1,179 @@
+package wiki
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// FindWikiCommits returns wiki commits on the wiki's branch, newest first:
+// the last n of them, or the ones revs name.
+func FindWikiCommits(gitRoot string, cfg *config.Config, last int, revs []string) ([]string, error) {
+	if err := trackWikiBranch(gitRoot, cfg); err != nil {
+		return nil, err
+	}
+	ref := commitRequest(gitRoot, cfg, nil).Ref
+	entries, err := git.GrepCommits(gitRoot, ref, cfg.CommitPrefix)
+	if err != nil {
+		return nil, err
+	}
+	var wikiCommits []string
+	for _, e := range entries {
+		if strings.HasPrefix(e.Subject, cfg.CommitPrefix) {
+			wikiCommits = append(wikiCommits, e.Hash)
+		}
+	}
+
+	if len(revs) == 0 {
+		if last > len(wikiCommits) {
+			return nil, fmt.Errorf("only %d wiki commits on %s", len(wikiCommits), ref)
+		}
+		return wikiCommits[:last], nil
+	}
+	want := map[string]bool{}
+	for _, rev := range revs {
+		hash := git.ResolveRef(gitRoot, rev)
+		if hash == "" {
+			return nil, fmt.Errorf("unknown commit %s", rev)
+		}
+		if !slices.Contains(wikiCommits, hash) {
+			return nil, fmt.Errorf("%s is not a wiki commit on %s", rev, ref)
+		}
+		want[hash] = true
+	}
+	var commits []string
+	for _, c := range wikiCommits {
+		if want[c] {
+			commits = append(commits, c)
+		}
+	}
+	return commits, nil
+}
+
+// RevertResult describes a revert.
+type RevertResult struct {
+	Commit string // the revert commit; "" if there was nothing to revert
+	From   string // LastCommitHash after the revert; the empty tree before the root commit
+	To     string // newest source commit whose wiki changes were reverted
+}
+
+// Revert undoes the wiki changes of commits (newest first) with a new wiki
+// commit, leaving all other files alone, and moves LastCommitHash back to
+// before the oldest source commit they document so the next update
+// reprocesses it. With hold, hook-triggered updates skip those source
+// commits instead; a manual update still regenerates them.
+func Revert(gitRoot string, cfg *config.Config, commits []string, hold bool) (*RevertResult, error) {
+	if err := lock(gitRoot); err != nil {
+		return nil, fmt.Errorf("cannot acquire lock: %w", err)
+	}
+	defer unlock(gitRoot)
+
+	if cfg.UsesWikiBranch() {
+		// The wiki directory is a copy of the branch; start from its tip.
+		if _, err := CheckoutWiki(gitRoot, cfg, ""); err != nil {
+			return nil, err
+		}
+	} else {
+		dirty, err := git.HasChanges(gitRoot, filepath.Join(gitRoot, cfg.WikiPath))
+		if err != nil {
+			return nil, err
+		}
+		if dirty {
+			return nil, fmt.Errorf("the wiki has uncommitted changes; commit or discard them first")
+		}
+	}
+
+	from, to, err := revertedSources(gitRoot, cfg, commits)
+	if err != nil {
+		return nil, err
+	}
+
+	before := takeSnapshot(gitRoot, cfg.WikiPath)
+	for _, c := range commits {
+		if err := git.ReversePatch(gitRoot, c, cfg.WikiPath); err != nil {
+			if rerr := applyChanges(gitRoot, takeSnapshot(gitRoot, cfg.WikiPath).diff(before)); rerr != nil {
+				logf(gitRoot, "failed to restore wiki after failed revert: %v", rerr)
+			}
+			return nil, fmt.Errorf("cannot revert %s; later wiki changes conflict with it, revert those too: %w", c, err)
+		}
+	}
+
+	saved, err := config.Load(gitRoot)
+	if err != nil {
+		return nil, err
+	}
+	saved.LastCommitHash = from
+	saved.NoRegenerate = nil
+	if hold {
+		saved.NoRegenerate = &config.SourceRange{From: from, To: to}
+	}
+	if err := config.Save(gitRoot, saved); err != nil {
+		return nil, err
+	}
+
+	description := fmt.Sprintf("revert %d wiki commits", len(commits))
+	if len(commits) == 1 {
+		msg, err := git.CommitMessage(gitRoot, commits[0])
+		if err != nil {
+			return nil, err
+		}
+		subject, _, _ := strings.Cut(msg, "\n")
+		description = fmt.Sprintf("revert %q", strings.TrimSpace(strings.TrimPrefix(subject, cfg.CommitPrefix)))
+	}
+	commit, err := CommitChanges(gitRoot, cfg, &CommitInfo{Description: description, Reverts: commits})
+	if err != nil {
+		return nil, err
+	}
+	logf(gitRoot, "reverted %d wiki commits, last commit hash reset to %s", len(commits), from)
+	return &RevertResult{Commit: commit, From: from, To: to}, nil
+}
+
+// revertedSources returns the range of source commits that commits
+// document: the parent of the oldest and the newest. If the oldest is the
+// root commit, the range starts at the empty tree. A wiki commit without a
+// source trailer on the working branch is taken to document its parent.
+func revertedSources(gitRoot string, cfg *config.Config, commits []string) (from string, to string, err error) {
+	var sources []string
+	for _, c := range commits {
+		t, err := git.Trailers(gitRoot, c)
+		if err != nil {
+			return "", "", err
+		}
+		s := t[SourceTrailer]
+		if len(s) == 0 && !cfg.UsesWikiBranch() {
+			if s, err = git.Parents(gitRoot, c); err != nil {
+				return "", "", err
+			}
+		}
+		sources = append(sources, s...)
+	}
+	if len(sources) == 0 {
+		return "", "", fmt.Errorf("the commits have no %s trailer; cannot tell which changes to reprocess", SourceTrailer)
+	}
+
+	oldest, newest := sources[0], sources[0]
+	for _, s := range sources[1:] {
+		if git.IsAncestor(gitRoot, s, oldest) {
+			oldest = s
+		}
+		if git.IsAncestor(gitRoot, newest, s) {
+			newest = s
+		}
+	}
+	parents, err := git.Parents(gitRoot, oldest)
+	if err != nil {
+		return "", "", err
+	}
+	if len(parents) > 0 {
+		return parents[0], newest, nil
+	}
+	// The oldest is the root commit; reprocess from the empty tree.
+	if from = git.EmptyTree(gitRoot); from == "" {
+		return "", "", fmt.Errorf("cannot reprocess from before the root commit %s", oldest)
+	}
+	return from, newest, nil
+}
@@ -0,0 +1,124 @@
+package wiki
+
+import (
+	"path"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+func TestRevertAndRegenerate(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	source := updateEach(t, r, "a.go")[0]
+	wikiCommit := r.head()
+
+	commits, err := FindWikiCommits(r.root, r.reload(), 1, nil)
+	if err != nil {
+		t.Fatalf("FindWikiCommits: %v", err)
+	}
+	if !slices.Equal(commits, []string{wikiCommit}) {
+		t.Fatalf("FindWikiCommits = %v, want [%s]", commits, wikiCommit)
+	}
+	res, err := Revert(r.root, r.reload(), commits, true)
+	if err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+
+	if res.Commit != r.head() {
+		t.Errorf("revert commit %s is not HEAD", res.Commit)
+	}
+	if r.exists(r.page("a.go")) {
+		t.Errorf("revert left %s", r.page("a.go"))
+	}
+	for _, p := range strings.Split(r.git("diff", "--name-only", "HEAD~1", "HEAD"), "\n") {
+		if !underDir(p, r.cfg.WikiPath) && p != ".repowiki/config.json" {
+			t.Errorf("revert commit touched %s", p)
+		}
+	}
+	trailers, err := git.Trailers(r.root, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := trailers[RevertTrailer]; !slices.Equal(got, []string{wikiCommit}) {
+		t.Errorf("%s = %v, want [%s]", RevertTrailer, got, wikiCommit)
+	}
+	cfg := r.reload()
+	parent := r.git("rev-parse", source+"~1")
+	if cfg.LastCommitHash != parent {
+		t.Errorf("LastCommitHash = %s, want the source commit's parent %s", cfg.LastCommitHash, parent)
+	}
+	if nr := cfg.NoRegenerate; nr == nil || nr.From != parent || nr.To != source {
+		t.Errorf("NoRegenerate = %+v, want %s..%s", nr, parent, source)
+	}
+
+	// A manual update reprocesses the reverted source commit.
+	if err := r.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+	if !r.exists(r.page("a.go")) {
+		t.Errorf("update after the revert did not regenerate %s", r.page("a.go"))
+	}
+}
+
+func TestRevertFirstGeneration(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+
+	commits, err := FindWikiCommits(r.root, r.reload(), 1, nil)
+	if err != nil {
+		t.Fatalf("FindWikiCommits: %v", err)
+	}
+	res, err := Revert(r.root, r.reload(), commits, false)
+	if err != nil {
+		t.Fatalf("Revert: %v", err)
+	}
+	if r.exists(r.page("main.go")) {
+		t.Errorf("revert left %s", r.page("main.go"))
+	}
+	empty := r.git("hash-object", "-t", "tree", "/dev/null")
+	if res.From != empty || r.reload().LastCommitHash != empty {
+		t.Errorf("From = %s, LastCommitHash = %s, want the empty tree %s", res.From, r.cfg.LastCommitHash, empty)
+	}
+
+	// The next update reprocesses everything from the root commit on.
+	if err := r.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+	if !r.exists(r.page("main.go")) {
+		t.Errorf("update after the revert did not regenerate %s", r.page("main.go"))
+	}
+	if last := r.reload().LastCommitHash; last != r.git("rev-parse", "HEAD~1") {
+		t.Errorf("LastCommitHash = %s after the update, want the commit it ran at", last)
+	}
+}
+
+func TestRevertRefusesConflictingLaterChanges(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	updateEach(t, r, "a.go")
+	older := r.head()
+	r.write("a.go", "package main\n\nfunc A() {}\n")
+	r.commit("change a.go")
+	if err := r.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+	head := r.head()
+	metaPath := path.Join(r.cfg.WikiPath, r.cfg.Language, "meta", "repowiki-metadata.json")
+	meta := r.read(metaPath)
+
+	if _, err := Revert(r.root, r.reload(), []string{older}, false); err == nil {
+		t.Fatalf("Revert of %s under a later change to the same files succeeded", older)
+	}
+	if r.head() != head {
+		t.Errorf("refused revert moved HEAD")
+	}
+	if got := r.read(metaPath); got != meta {
+		t.Errorf("refused revert left the wiki changed")
+	}
+	if status := r.git("status", "--porcelain", "--", ".", ":!.repowiki"); status != "" {
+		t.Errorf("working tree not clean after the refused revert:\n%s", status)
+	}
+}
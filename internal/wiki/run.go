@@ -0,0 +1,70 @@
+package wiki
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/engine"
+	"github.com/GoooIce/repowiki/internal/history"
+)
+
+// activeRun accumulates the history record for one generation.
+type activeRun struct {
+	rec     history.Run
+	started time.Time
+}
+
+func startRun(cfg *config.Config, kind string, commitHash string) *activeRun {
+	now := time.Now().UTC()
+	return &activeRun{
+		started: now,
+		rec: history.Run{
+			ID:      now.Format("20060102T150405.000Z"),
+			Kind:    kind,
+			Commit:  commitHash,
+			Engine:  cfg.Engine,
+			Model:   cfg.Model,
+			Started: now.Format(time.RFC3339),
+		},
+	}
+}
+
+// setResult notes which engine and model actually produced the result,
+// which differs from the configured ones after a fallback, and its usage.
+func (r *activeRun) setResult(result *engine.Result) {
+	if result == nil {
+		return
+	}
+	if result.Engine != "" {
+		r.rec.Engine = result.Engine
+		r.rec.Model = result.Model
+	}
+	r.rec.Usage = result.Usage
+}
+
+// finish records the run's outcome in the run history.
+func (r *activeRun) finish(gitRoot string, err error) {
+	r.rec.DurationMS = time.Since(r.started).Milliseconds()
+	switch {
+	case err == nil:
+		r.rec.Status = history.StatusOK
+	case errors.Is(err, context.Canceled):
+		r.rec.Status = history.StatusCanceled
+		r.rec.Error = err.Error()
+	case errors.Is(err, engine.ErrTimeout):
+		r.rec.Status = history.StatusTimedOut
+		r.rec.Error = err.Error()
+	default:
+		r.rec.Status = history.StatusFailed
+		r.rec.Error = err.Error()
+	}
+	var verr *ViolationError
+	if errors.As(err, &verr) {
+		r.rec.Violations = verr.Paths
+	}
+	if err := history.Append(gitRoot, &r.rec); err != nil {
+		logf(gitRoot, "failed to record run history: %v", err)
+	}
+}
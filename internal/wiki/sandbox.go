@@ -0,0 +1,92 @@
+package wiki
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/engine"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// sandbox is a throwaway worktree the engine runs in, so it can't touch
+// uncommitted work or source files in the user's checkout.
+type sandbox struct {
+	gitRoot string
+	dir     string
+	before  snapshot // wiki files as copied in from the checkout
+}
+
+// newSandbox checks out commitHash into a temporary worktree and copies
+// the checkout's current wiki into it, uncommitted edits included.
+func newSandbox(gitRoot string, wikiPath string, commitHash string) (*sandbox, error) {
+	if commitHash == "" {
+		commitHash = "HEAD"
+	}
+	dir, err := os.MkdirTemp("", "repowiki-sandbox-")
+	if err != nil {
+		return nil, err
+	}
+	if err := git.AddWorktree(gitRoot, dir, commitHash); err != nil {
+		os.RemoveAll(dir)
+		return nil, err
+	}
+
+	sb := &sandbox{gitRoot: gitRoot, dir: dir, before: takeSnapshot(gitRoot, wikiPath)}
+	if err := os.RemoveAll(filepath.Join(dir, wikiPath)); err != nil {
+		sb.remove()
+		return nil, err
+	}
+	if err := applyChanges(dir, snapshot{}.diff(sb.before)); err != nil {
+		sb.remove()
+		return nil, err
+	}
+	return sb, nil
+}
+
+// copyBack applies the engine's wiki changes to the checkout.
+func (sb *sandbox) copyBack(wikiPath string) ([]FileChange, error) {
+	changes := sb.before.diff(takeSnapshot(sb.dir, wikiPath))
+	return changes, applyChanges(sb.gitRoot, changes)
+}
+
+func (sb *sandbox) remove() {
+	if err := git.RemoveWorktree(sb.gitRoot, sb.dir); err != nil {
+		os.RemoveAll(sb.dir)
+		git.PruneWorktrees(sb.gitRoot)
+	}
+}
+
+// runSandboxed runs the engine in a fresh worktree at commitHash. Wiki
+// changes are copied back only if the run succeeds; the checkout is never
+// touched otherwise.
+func runSandboxed(ctx context.Context, gitRoot string, cfg *config.Config, commitHash string, prompt string, opts *Options) (*engine.Result, error) {
+	sb, err := newSandbox(gitRoot, cfg.WikiPath, commitHash)
+	if err != nil {
+		return nil, fmt.Errorf("creating sandbox worktree: %w", err)
+	}
+	defer sb.remove()
+	logf(gitRoot, "running engine in sandbox %s", sb.dir)
+
+	g, err := startGuard(gitRoot, sb.dir, cfg.WikiPath)
+	if err != nil {
+		return nil, err
+	}
+	result, err := invokeEngine(ctx, gitRoot, sb.dir, cfg, prompt, opts)
+	err = joinViolation(err, g.check())
+	if err != nil {
+		if ctx.Err() != nil {
+			err = fmt.Errorf("engine run %w", ctx.Err())
+		}
+		return result, err
+	}
+
+	changes, err := sb.copyBack(cfg.WikiPath)
+	if err != nil {
+		return result, fmt.Errorf("copying wiki changes from sandbox: %w", err)
+	}
+	logf(gitRoot, "copied %d wiki file changes from sandbox", len(changes))
+	return result, nil
+}
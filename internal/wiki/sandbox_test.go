@@ -0,0 +1,38 @@
+package wiki
+
+import (
+	"os"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/config"
+)
+
+func TestSandboxIgnoresHookIndexFile(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	// An engine that uses git in the sandbox, as real engines do.
+	r.reload().Engine = "gitty"
+	r.cfg.Engines = map[string]config.EngineSettings{
+		"gitty": {Command: []string{"sh", "-c",
+			"git status --porcelain >/dev/null && mkdir -p .qoder/repowiki/en/content && echo page > .qoder/repowiki/en/content/Status.md"}},
+	}
+	r.saveConfig()
+	r.write("util.go", "package main\n")
+	r.commit("add util")
+
+	// Hooks run with the checkout's index exported by a relative path.
+	t.Chdir(r.root)
+	t.Setenv("GIT_INDEX_FILE", ".git/index")
+	if err := r.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+	if !r.exists(".qoder/repowiki/en/content/Status.md") {
+		t.Errorf("sandboxed engine's page was not copied back")
+	}
+	if got := os.Getenv("GIT_INDEX_FILE"); got != ".git/index" {
+		t.Errorf("GIT_INDEX_FILE = %q after the run, want it left alone", got)
+	}
+	if status := r.git("status", "--porcelain", "--", ".", ":!.repowiki"); status != "" {
+		t.Errorf("working tree not clean after the update:\n%s", status)
+	}
+}
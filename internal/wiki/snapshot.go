@@ -0,0 +1,107 @@
+package wiki
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// FileChange is a single file difference in the wiki directory. Paths are
+// slash-separated and relative to the git root. Content is base64 in JSON,
+// so binary assets survive cassettes and changesets.
+type FileChange struct {
+	Path    string `json:"path"`
+	Content []byte `json:"content,omitempty"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+// snapshot holds the contents of every file under a directory, keyed by
+// slash-separated path relative to the git root.
+type snapshot map[string][]byte
+
+func takeSnapshot(gitRoot string, relDir string) snapshot {
+	snap := snapshot{}
+	root := filepath.Join(gitRoot, relDir)
+	filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return nil
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(gitRoot, path)
+		if err != nil {
+			return nil
+		}
+		snap[filepath.ToSlash(rel)] = data
+		return nil
+	})
+	return snap
+}
+
+// diff returns the changes that turn s into after, sorted by path.
+func (s snapshot) diff(after snapshot) []FileChange {
+	var changes []FileChange
+	for path, data := range after {
+		if old, ok := s[path]; !ok || !bytes.Equal(old, data) {
+			changes = append(changes, FileChange{Path: path, Content: data})
+		}
+	}
+	for path := range s {
+		if _, ok := after[path]; !ok {
+			changes = append(changes, FileChange{Path: path, Deleted: true})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes
+}
+
+// removeEmptyDirs removes dir and its parents while they are empty, stopping
+// at root.
+func removeEmptyDirs(root string, dir string) {
+	for dir != root && strings.HasPrefix(dir, root+string(filepath.Separator)) {
+		if os.Remove(dir) != nil { // fails unless empty
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// checkChanges rejects changes read from disk (cassettes, changesets) whose
+// paths would land outside the wiki directory.
+func checkChanges(changes []FileChange, wikiPath string) error {
+	for _, c := range changes {
+		p := c.Path
+		if path.IsAbs(p) || path.Clean(p) != p || strings.Contains(p, "\\") || !underDir(p, wikiPath) {
+			return fmt.Errorf("path %q is outside the wiki directory %s", c.Path, wikiPath)
+		}
+	}
+	return nil
+}
+
+// applyChanges writes a list of file changes into the working tree.
+func applyChanges(gitRoot string, changes []FileChange) error {
+	for _, c := range changes {
+		path := filepath.Join(gitRoot, filepath.FromSlash(c.Path))
+		if c.Deleted {
+			if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removeEmptyDirs(gitRoot, filepath.Dir(path))
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := os.WriteFile(path, c.Content, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
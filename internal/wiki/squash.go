@@ -0,0 +1,125 @@
+package wiki
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// ErrInterleaved is returned by Squash when the unpushed wiki commits are
+// separated by other commits, so folding them would need a rebase.
+var ErrInterleaved = errors.New("unpushed wiki commits are interleaved with other commits; squashing them would need a rebase")
+
+// Squash folds the consecutive unpushed wiki commits at the tip of the
+// wiki's branch into one. It returns how many commits were folded and how
+// many older unpushed wiki commits were left alone because other commits
+// sit between them and the tip.
+func Squash(gitRoot string, cfg *config.Config) (folded int, stranded int, err error) {
+	if err := lock(gitRoot); err != nil {
+		return 0, 0, fmt.Errorf("cannot acquire lock: %w", err)
+	}
+	defer unlock(gitRoot)
+
+	ref := commitRequest(gitRoot, cfg, nil).Ref
+	run, stranded, err := wikiRun(gitRoot, cfg, ref)
+	if err != nil {
+		return 0, 0, err
+	}
+	if len(run) < 2 {
+		if stranded > 0 {
+			return 0, stranded, ErrInterleaved
+		}
+		return 0, 0, nil
+	}
+	commit, err := squashRun(gitRoot, cfg, ref, run)
+	if err != nil {
+		return 0, stranded, err
+	}
+	logf(gitRoot, "squashed %d wiki commits into %s", len(run), commit)
+	return len(run), stranded, nil
+}
+
+// amendPrevious folds the wiki commit just made into the one before it, if
+// that one is an unpushed wiki commit directly below it.
+func amendPrevious(gitRoot string, cfg *config.Config) error {
+	ref := commitRequest(gitRoot, cfg, nil).Ref
+	run, _, err := wikiRun(gitRoot, cfg, ref)
+	if err != nil || len(run) < 2 {
+		return err
+	}
+	commit, err := squashRun(gitRoot, cfg, ref, run[len(run)-2:])
+	if err != nil {
+		return err
+	}
+	logf(gitRoot, "amended previous wiki commit, now %s", commit)
+	return nil
+}
+
+// wikiRun returns the unpushed wiki commits at the tip of ref, oldest
+// first, and counts the older unpushed wiki commits behind other commits.
+func wikiRun(gitRoot string, cfg *config.Config, ref string) (run []string, stranded int, err error) {
+	unpushed, err := git.UnpushedCommits(gitRoot, ref)
+	if err != nil {
+		return nil, 0, err
+	}
+	atTip := true
+	for _, c := range unpushed {
+		isWiki := strings.HasPrefix(c.Subject, cfg.CommitPrefix) && len(c.Parents) <= 1
+		switch {
+		case isWiki && atTip:
+			run = append([]string{c.Hash}, run...)
+		case isWiki:
+			stranded++
+		default:
+			atTip = false
+		}
+	}
+	return run, stranded, nil
+}
+
+// squashRun replaces run, consecutive commits ending at ref's tip (oldest
+// first), with one commit carrying all their trailers.
+func squashRun(gitRoot string, cfg *config.Config, ref string, run []string) (string, error) {
+	t := trailers{}
+	for _, c := range run {
+		found, err := git.Trailers(gitRoot, c)
+		if err != nil {
+			return "", err
+		}
+		for _, key := range []string{SourceTrailer, EngineTrailer, ModelTrailer, RevertTrailer} {
+			for _, v := range found[key] {
+				t.add(key, v)
+			}
+		}
+	}
+
+	tip := run[len(run)-1]
+	description := fmt.Sprintf("update wiki for %d source commits", len(t[SourceTrailer]))
+	if len(t[SourceTrailer]) <= 1 {
+		// Repeated runs for one commit keep the latest subject.
+		msg, err := git.CommitMessage(gitRoot, tip)
+		if err != nil {
+			return "", err
+		}
+		subject, _, _ := strings.Cut(msg, "\n")
+		description = strings.TrimSpace(strings.TrimPrefix(subject, cfg.CommitPrefix))
+	}
+
+	base := ""
+	parents, err := git.Parents(gitRoot, run[0])
+	if err != nil {
+		return "", err
+	}
+	if len(parents) > 0 {
+		base = parents[0]
+	}
+
+	req := commitRequest(gitRoot, cfg, nil)
+	req.Message = func(changes []git.TreeChange) string {
+		return formatMessage(cfg, description, t, changes)
+	}
+	return git.SquashCommits(gitRoot, base, tip, req)
+}
@@ -0,0 +1,92 @@
+package wiki
+
+import (
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+// updateEach commits each file and runs an update for it, returning the
+// source commits.
+func updateEach(t *testing.T, r *testRepo, files ...string) []string {
+	t.Helper()
+	var sources []string
+	for _, f := range files {
+		r.write(f, "package main\n")
+		sources = append(sources, r.commit("add "+f))
+		if err := r.update(nil); err != nil {
+			t.Fatalf("IncrementalUpdate: %v", err)
+		}
+	}
+	return sources
+}
+
+func TestSquashFoldsWikiBranchCommits(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, func(cfg *config.Config) {
+		cfg.Storage = config.StorageBranch
+	})
+	r.generate()
+	sources := append([]string{r.head()}, updateEach(t, r, "a.go", "b.go")...)
+	ref := r.cfg.WikiBranchRef()
+	tree := r.git("rev-parse", ref+"^{tree}")
+
+	folded, stranded, err := Squash(r.root, r.reload())
+	if err != nil {
+		t.Fatalf("Squash: %v", err)
+	}
+	if folded != 3 || stranded != 0 {
+		t.Errorf("Squash folded %d and stranded %d, want 3 and 0", folded, stranded)
+	}
+	if n := r.git("rev-list", "--count", ref); n != "1" {
+		t.Errorf("%s has %s commits after squashing, want 1", ref, n)
+	}
+	if got := r.git("rev-parse", ref+"^{tree}"); got != tree {
+		t.Errorf("squashed tree %s, want the last commit's tree %s", got, tree)
+	}
+	trailers, err := git.Trailers(r.root, ref)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := trailers[SourceTrailer]; !slices.Equal(got, sources) {
+		t.Errorf("%s = %v, want %v", SourceTrailer, got, sources)
+	}
+}
+
+func TestSquashRefusesInterleavedCommits(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, nil)
+	r.generate()
+	updateEach(t, r, "a.go")
+	head := r.head()
+
+	folded, stranded, err := Squash(r.root, r.reload())
+	if !errors.Is(err, ErrInterleaved) {
+		t.Fatalf("Squash error = %v, want ErrInterleaved", err)
+	}
+	if folded != 0 || stranded != 1 {
+		t.Errorf("Squash folded %d and stranded %d, want 0 and 1", folded, stranded)
+	}
+	if r.head() != head {
+		t.Errorf("refused squash moved HEAD")
+	}
+}
+
+func TestAmendWikiCommits(t *testing.T) {
+	r := newTestRepo(t, map[string]string{"main.go": "package main\n"}, func(cfg *config.Config) {
+		cfg.Storage = config.StorageBranch
+		cfg.AmendWikiCommits = true
+	})
+	r.generate()
+	updateEach(t, r, "a.go", "b.go")
+
+	ref := r.cfg.WikiBranchRef()
+	if n := r.git("rev-list", "--count", ref); n != "1" {
+		t.Errorf("%s has %s commits with amend_wiki_commits, want 1", ref, n)
+	}
+	if pages := r.git("ls-tree", "-r", "--name-only", ref); !strings.Contains(pages, r.page("b.go")) {
+		t.Errorf("amended commit is missing %s:\n%s", r.page("b.go"), pages)
+	}
+}
@@ -1,81 +1,186 @@
 package wiki
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"time"
 
 	"github.com/GoooIce/repowiki/internal/config"
+	"github.com/GoooIce/repowiki/internal/engine"
+	"github.com/GoooIce/repowiki/internal/git"
+	"github.com/GoooIce/repowiki/internal/history"
 	"github.com/GoooIce/repowiki/internal/lockfile"
 )
 
+// Options controls how a generation run invokes the engine. A nil *Options
+// runs the configured engine normally.
+type Options struct {
+	Record string // directory to record engine cassettes into
+	Replay string // directory to replay engine cassettes from
+
+	// Patch and PatchDir write the wiki changes as a format-patch file
+	// (to that file, or into that directory) instead of committing them,
+	// and restore the wiki afterwards. The file written is reported in
+	// PatchFile.
+	Patch     string
+	PatchDir  string
+	PatchFile string
+
+	replayed int // cassettes consumed so far from Replay
+}
+
+func (o *Options) patching() bool {
+	return o != nil && (o.Patch != "" || o.PatchDir != "")
+}
+
 // FullGenerate performs a complete wiki generation from scratch.
-func FullGenerate(gitRoot string, cfg *config.Config, commitHash string) error {
-	if err := lockfile.Acquire(gitRoot); err != nil {
+func FullGenerate(ctx context.Context, gitRoot string, cfg *config.Config, commitHash string, opts *Options) (err error) {
+	if err := lock(gitRoot); err != nil {
 		return fmt.Errorf("cannot acquire lock: %w", err)
 	}
-	defer lockfile.Release(gitRoot)
+	defer unlock(gitRoot)
+	if opts.patching() {
+		if err := checkPatchBase(gitRoot, cfg); err != nil {
+			return err
+		}
+	}
+
+	run := startRun(cfg, history.KindFull, commitHash)
+	defer func() { run.finish(gitRoot, err) }()
 
 	logf(gitRoot, "starting full wiki generation")
+	cfg = routeModel(gitRoot, cfg, config.Change{Kind: history.KindFull})
 
 	prompt := BuildFullGeneratePrompt(cfg)
 
-	output, err := RunEngine(cfg, gitRoot, prompt)
+	before := takeSnapshot(gitRoot, cfg.WikiPath)
+	result, err := runEngine(ctx, gitRoot, cfg, commitHash, prompt, opts)
+	run.setResult(result)
 	if err != nil {
-		logf(gitRoot, "engine failed: %v", err)
+		logEngineError(gitRoot, err)
 		return fmt.Errorf("wiki generation failed: %w", err)
 	}
 
-	logf(gitRoot, "engine completed, output length: %d", len(output))
+	logEngineResult(gitRoot, result)
 
-	if cfg.AutoCommit {
-		config.UpdateLastRun(gitRoot, commitHash)
-		if err := CommitChanges(gitRoot, cfg, "full wiki generation"); err != nil {
-			logf(gitRoot, "auto-commit failed: %v", err)
-			return err
-		}
-		logf(gitRoot, "wiki changes committed")
-	}
-
-	return nil
+	return deliver(gitRoot, cfg, run.rec.ID, commitInfo(commitHash, "full wiki generation", result), before, opts)
 }
 
 // IncrementalUpdate updates wiki for specific changed files.
-func IncrementalUpdate(gitRoot string, cfg *config.Config, changedFiles []string, commitHash string) error {
-	if err := lockfile.Acquire(gitRoot); err != nil {
+func IncrementalUpdate(ctx context.Context, gitRoot string, cfg *config.Config, changedFiles []string, commitHash string, opts *Options) (err error) {
+	if err := lock(gitRoot); err != nil {
 		return fmt.Errorf("cannot acquire lock: %w", err)
 	}
-	defer lockfile.Release(gitRoot)
+	defer unlock(gitRoot)
+	if opts.patching() {
+		if err := checkPatchBase(gitRoot, cfg); err != nil {
+			return err
+		}
+	}
+
+	run := startRun(cfg, history.KindIncremental, commitHash)
+	defer func() { run.finish(gitRoot, err) }()
 
 	logf(gitRoot, "starting incremental update for %d files", len(changedFiles))
 
 	affectedSections := AffectedSections(gitRoot, cfg, changedFiles)
 	logf(gitRoot, "affected sections: %v", affectedSections)
 
+	base := cfg.LastCommitHash
+	if base == commitHash {
+		base = ""
+	}
+	lines, err := git.DiffLines(gitRoot, base, commitHash, changedFiles)
+	if err != nil {
+		logf(gitRoot, "counting diff lines failed: %v", err)
+	}
+	cfg = routeModel(gitRoot, cfg, config.Change{
+		Kind:     history.KindIncremental,
+		Files:    len(changedFiles),
+		Lines:    lines,
+		Sections: len(affectedSections),
+	})
+
 	prompt := BuildIncrementalPrompt(cfg, changedFiles, affectedSections)
 
-	output, err := RunEngine(cfg, gitRoot, prompt)
+	before := takeSnapshot(gitRoot, cfg.WikiPath)
+	result, err := runEngine(ctx, gitRoot, cfg, commitHash, prompt, opts)
+	run.setResult(result)
 	if err != nil {
-		logf(gitRoot, "engine failed: %v", err)
+		logEngineError(gitRoot, err)
 		return fmt.Errorf("wiki update failed: %w", err)
 	}
 
-	logf(gitRoot, "engine completed, output length: %d", len(output))
+	logEngineResult(gitRoot, result)
+
+	desc := fmt.Sprintf("update wiki for %d changed files", len(changedFiles))
+	return deliver(gitRoot, cfg, run.rec.ID, commitInfo(commitHash, desc, result), before, opts)
+}
 
-	if cfg.AutoCommit {
-		config.UpdateLastRun(gitRoot, commitHash)
-		desc := fmt.Sprintf("update wiki for %d changed files", len(changedFiles))
-		if err := CommitChanges(gitRoot, cfg, desc); err != nil {
+// deliver hands on the wiki changes of a successful run: written as a
+// patch, held for review, committed, or (without auto-commit) left in the
+// working tree. Commits are pushed if configured. before is the wiki as it
+// was before the run.
+func deliver(gitRoot string, cfg *config.Config, runID string, info *CommitInfo, before snapshot, opts *Options) error {
+	switch {
+	case opts.patching():
+		file, err := writePatch(gitRoot, cfg, info, opts)
+		if rerr := applyChanges(gitRoot, takeSnapshot(gitRoot, cfg.WikiPath).diff(before)); rerr != nil {
+			logf(gitRoot, "failed to restore wiki after writing patch: %v", rerr)
+		}
+		if err != nil {
+			logf(gitRoot, "writing patch failed: %v", err)
+			return err
+		}
+		opts.PatchFile = file
+		if file != "" {
+			logf(gitRoot, "wiki changes written to %s", file)
+		}
+	case cfg.Review:
+		// The source commits count as processed once the changeset is
+		// accepted; until then later runs cover them again.
+		n, err := holdForReview(gitRoot, cfg, runID, info, before)
+		if err != nil {
+			logf(gitRoot, "saving changeset for review failed: %v", err)
+			return err
+		}
+		if n == 0 {
+			config.UpdateLastRun(gitRoot, info.Source)
+		} else {
+			logf(gitRoot, "%d wiki file changes saved for review as %s", n, runID)
+		}
+	case cfg.AutoCommit:
+		config.UpdateLastRun(gitRoot, info.Source)
+		commit, err := CommitChanges(gitRoot, cfg, info)
+		if err != nil {
 			logf(gitRoot, "auto-commit failed: %v", err)
 			return err
 		}
 		logf(gitRoot, "wiki changes committed")
+		if cfg.AmendWikiCommits && commit != "" {
+			if err := amendPrevious(gitRoot, cfg); err != nil {
+				logf(gitRoot, "amending previous wiki commit failed: %v", err)
+			}
+		}
+		if cfg.AutoPush && commit != "" {
+			return push(gitRoot, cfg)
+		}
 	}
-
 	return nil
 }
 
+func commitInfo(commitHash string, description string, result *engine.Result) *CommitInfo {
+	return &CommitInfo{
+		Source:      commitHash,
+		Description: description,
+		Engine:      result.Engine,
+		Model:       result.Model,
+	}
+}
+
 // Exists checks if the wiki directory has content.
 func Exists(gitRoot string, cfg *config.Config) bool {
 	contentPath := filepath.Join(gitRoot, cfg.WikiPath, cfg.Language, "content")
@@ -83,6 +188,107 @@ func Exists(gitRoot string, cfg *config.Config) bool {
 	return err == nil && len(entries) > 0
 }
 
+// FilterExcluded drops files under any of the excluded path prefixes.
+func FilterExcluded(files []string, excluded []string) []string {
+	var result []string
+	for _, f := range files {
+		skip := false
+		for _, ex := range excluded {
+			if len(f) >= len(ex) && f[:len(ex)] == ex {
+				skip = true
+				break
+			}
+		}
+		if !skip {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// routeModel applies the engines' model routes for ch and logs the model
+// picked for the primary engine.
+func routeModel(gitRoot string, cfg *config.Config, ch config.Change) *config.Config {
+	routed := cfg.Routed(ch)
+	m := routed.SettingsFor(cfg.Engine).RouteModel(ch)
+	switch {
+	case m == "":
+	case ch.Kind == history.KindFull:
+		logf(gitRoot, "routed full generation to model %s", m)
+	default:
+		logf(gitRoot, "routed to model %s (%d files, %d lines, %d sections)", m, ch.Files, ch.Lines, ch.Sections)
+	}
+	return routed
+}
+
+// runEngine invokes the engine with the lock tracking its process, in a
+// sandbox worktree if configured. Changes outside the wiki fail the run and
+// are reverted. If a run in the checkout is canceled or times out, wiki
+// files it partially wrote are reverted too.
+func runEngine(ctx context.Context, gitRoot string, cfg *config.Config, commitHash string, prompt string, opts *Options) (*engine.Result, error) {
+	ctx = engine.WithStartHook(ctx, func(pid int) {
+		lockfile.SetEnginePID(gitRoot, pid)
+	})
+	if opts != nil && opts.Replay != "" {
+		return invokeEngine(ctx, gitRoot, gitRoot, cfg, prompt, opts)
+	}
+	if cfg.Sandboxed() {
+		return runSandboxed(ctx, gitRoot, cfg, commitHash, prompt, opts)
+	}
+	g, err := startGuard(gitRoot, gitRoot, cfg.WikiPath)
+	if err != nil {
+		return nil, err
+	}
+	before := takeSnapshot(gitRoot, cfg.WikiPath)
+
+	result, err := invokeEngine(ctx, gitRoot, gitRoot, cfg, prompt, opts)
+	err = joinViolation(err, g.check())
+	if err == nil {
+		return result, nil
+	}
+	if ctx.Err() != nil {
+		err = fmt.Errorf("engine run %w", ctx.Err())
+	}
+	if errors.Is(err, context.Canceled) || errors.Is(err, engine.ErrTimeout) {
+		restoreWiki(gitRoot, gitRoot, cfg.WikiPath, before)
+	}
+	return result, err
+}
+
+// invokeEngine invokes the configured engine in dir, or records/replays it
+// per opts.
+func invokeEngine(ctx context.Context, gitRoot string, dir string, cfg *config.Config, prompt string, opts *Options) (*engine.Result, error) {
+	switch {
+	case opts != nil && opts.Replay != "":
+		return replayEngine(gitRoot, cfg, prompt, opts)
+	case opts != nil && opts.Record != "":
+		return recordEngine(ctx, gitRoot, dir, cfg, prompt, opts.Record)
+	default:
+		return runChain(ctx, gitRoot, dir, cfg, prompt)
+	}
+}
+
+func logEngineError(gitRoot string, err error) {
+	if errors.Is(err, context.Canceled) {
+		logf(gitRoot, "engine canceled: %v", err)
+		return
+	}
+	if errors.Is(err, engine.ErrTimeout) {
+		logf(gitRoot, "engine timed out, process group killed: %v", err)
+		return
+	}
+	logf(gitRoot, "engine failed: %v", err)
+}
+
+func logEngineResult(gitRoot string, result *engine.Result) {
+	if u := result.Usage; u != nil {
+		logf(gitRoot, "engine completed, output length: %d, tokens in/out/cached: %d/%d/%d, turns: %d, cost: $%.4f",
+			len(result.Output), u.InputTokens, u.OutputTokens, u.CacheReadTokens+u.CacheCreationTokens, u.Turns, u.CostUSD)
+		return
+	}
+	logf(gitRoot, "engine completed, output length: %d", len(result.Output))
+}
+
 func logf(gitRoot string, format string, args ...any) {
 	logDir := config.LogPath(gitRoot)
 	os.MkdirAll(logDir, 0755)
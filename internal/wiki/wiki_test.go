@@ -0,0 +1,59 @@
+package wiki
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/GoooIce/repowiki/internal/git"
+)
+
+func TestIncrementalUpdate(t *testing.T) {
+	r := newTestRepo(t, map[string]string{
+		"main.go":     "package main\n\nfunc main() {}\n",
+		"util/str.go": "package util\n",
+	}, nil)
+	r.generate()
+	if !r.exists(r.page("main.go")) || !r.exists(r.page("util/str.go")) {
+		t.Fatalf("full generation did not write pages for every source file")
+	}
+
+	r.write("util/str.go", "package util\n\nfunc Trim() {}\n")
+	r.write("util/num.go", "package util\n")
+	source := r.commit("add num")
+	if err := r.update(nil); err != nil {
+		t.Fatalf("IncrementalUpdate: %v", err)
+	}
+
+	if got := r.read(r.page("util/num.go")); !strings.Contains(got, "# util/num.go") {
+		t.Errorf("page for util/num.go = %q", got)
+	}
+	if last := r.reload().LastCommitHash; last != source {
+		t.Errorf("LastCommitHash = %s, want %s", last, source)
+	}
+
+	msg, err := git.CommitMessage(r.root, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(msg, "[repowiki] update wiki for 2 changed files") {
+		t.Errorf("wiki commit subject = %q", msg)
+	}
+	trailers, err := git.Trailers(r.root, "HEAD")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := trailers[SourceTrailer]; len(got) != 1 || got[0] != source {
+		t.Errorf("%s = %v, want %s", SourceTrailer, got, source)
+	}
+	if got := trailers[EngineTrailer]; len(got) != 1 || got[0] != "fake" {
+		t.Errorf("%s = %v, want fake", EngineTrailer, got)
+	}
+	for _, p := range strings.Split(r.git("diff", "--name-only", "HEAD~1", "HEAD"), "\n") {
+		if !underDir(p, r.cfg.WikiPath) && !underDir(p, ".repowiki") {
+			t.Errorf("wiki commit touched %s", p)
+		}
+	}
+	if status := r.git("status", "--porcelain", "--", ".", ":!.repowiki"); status != "" {
+		t.Errorf("working tree not clean after update:\n%s", status)
+	}
+}